@@ -0,0 +1,211 @@
+package api
+
+import (
+	"CoinbaseMatchesVWAP/metrics"
+	"CoinbaseMatchesVWAP/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// PairResponse - models VWAP data of a single trading pair returned by the API
+type PairResponse struct {
+	Pair string `json:"pair"`
+	// VWAP - null while slide window is empty
+	VWAP *float64 `json:"vwap"`
+	// ExactVWAP - VWAP with all digits of configured scale, only in decimal mode
+	ExactVWAP       string  `json:"exact_vwap,omitempty"`
+	CalculationMode string  `json:"calculation_mode"`
+	WindowType      string  `json:"window_type"`
+	Window          int     `json:"window,omitempty"`
+	WindowDuration  string  `json:"window_duration,omitempty"`
+	Trades          int     `json:"trades"`
+	WindowFill      float64 `json:"window_fill"`
+	// MinPrice and MaxPrice - null while slide window is empty
+	MinPrice        *float64   `json:"min_price"`
+	MaxPrice        *float64   `json:"max_price"`
+	CumulatedVolume float64    `json:"cumulated_volume"`
+	LastTradeTime   *time.Time `json:"last_trade_time"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+	Degraded        bool       `json:"degraded"`
+	// Alert - "above" or "below" while VWAP is beyond an alert threshold of trading pair
+	Alert string `json:"alert,omitempty"`
+	// Status - subscription status of trading pair: "pending", "subscribed", "rejected" or "stale"
+	Status       string `json:"status,omitempty"`
+	StatusReason string `json:"status_reason,omitempty"`
+	// Sequence - counts of missing, duplicate and out of order matches of trading pair, not set for windows
+	Sequence *SequenceResponse `json:"sequence,omitempty"`
+	// Windows - all slide windows of trading pair, the first one is the primary window described above
+	Windows []PairResponse `json:"windows,omitempty"`
+}
+
+// SequenceResponse - models counts of sequence anomalies of a trading pair
+type SequenceResponse struct {
+	Gaps       int `json:"gaps"`
+	Duplicates int `json:"duplicates"`
+	OutOfOrder int `json:"out_of_order"`
+}
+
+// errorResponse - models an error returned by the API
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server - HTTP server exposing current VWAP of trading pairs
+type Server struct {
+	aggregator  *utils.Aggregator
+	server      *http.Server
+	broadcaster *Broadcaster
+	upgrader    websocket.Upgrader
+	// closing - closed on shutdown, ends streaming requests which would otherwise never finish
+	closing chan struct{}
+	once    sync.Once
+}
+
+// NewServer - initializes a new server listening on address, streaming updates of aggregator
+func NewServer(address string, aggregator *utils.Aggregator, streamConfig StreamConfig) *Server {
+	s := &Server{
+		aggregator:  aggregator,
+		broadcaster: NewBroadcaster(streamConfig),
+		upgrader:    newUpgrader(),
+		closing:     make(chan struct{}),
+	}
+	aggregator.OnUpdate(s.broadcaster.Publish)
+	s.server = &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+	return s
+}
+
+// Handler - returns handler serving all API endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vwap", s.handleVWAP)
+	mux.HandleFunc("/vwap/", s.handlePairVWAP)
+	mux.HandleFunc("/stream", s.handleSSE)
+	mux.HandleFunc("/stream/ws", s.handleWebsocket)
+	mux.Handle("/metrics", metrics.Handler(s.aggregator.Snapshot))
+	return mux
+}
+
+// Start - starts listening, and serves requests in background.
+// Returns an error if server can't listen on its address, e.g. because it is already in use.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("HTTP API listening on %s", listener.Addr())
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("HTTP API failed:", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown - stops server, waiting for in-flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.once.Do(func() {
+		close(s.closing)
+	})
+	return s.server.Shutdown(ctx)
+}
+
+// handleVWAP - serves VWAP data of all trading pairs
+func (s *Server) handleVWAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+
+	response := []PairResponse{}
+	for _, snapshot := range s.aggregator.Snapshot() {
+		response = append(response, NewPairResponse(snapshot))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handlePairVWAP - serves VWAP data of trading pair in path (/vwap/{pair})
+func (s *Server) handlePairVWAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+
+	pair := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/vwap/"))
+	snapshot, ok := s.aggregator.PairSnapshot(pair)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "unknown trading pair " + pair})
+		return
+	}
+	writeJSON(w, http.StatusOK, NewPairResponse(snapshot))
+}
+
+// NewPairResponse - converts a snapshot to its API representation
+func NewPairResponse(snapshot utils.VWAPSnapshot) PairResponse {
+	response := PairResponse{
+		Pair:            snapshot.Pair,
+		CalculationMode: snapshot.CalculationMode,
+		WindowType:      snapshot.WindowType,
+		Window:          snapshot.Window,
+		Trades:          snapshot.Trades,
+		WindowFill:      snapshot.WindowFill,
+		CumulatedVolume: snapshot.CumulatedVolume,
+		Degraded:        snapshot.Degraded,
+		ExactVWAP:       snapshot.ExactVWAP,
+		Alert:           snapshot.Alert,
+		Status:          snapshot.Status,
+		StatusReason:    snapshot.StatusReason,
+	}
+
+	if snapshot.WindowDuration > 0 {
+		response.WindowDuration = snapshot.WindowDuration.String()
+	}
+	if !math.IsNaN(snapshot.VWAP) && !math.IsInf(snapshot.VWAP, 0) {
+		response.VWAP = &snapshot.VWAP
+	}
+	if snapshot.Trades > 0 {
+		response.MinPrice = &snapshot.MinPrice
+		response.MaxPrice = &snapshot.MaxPrice
+	}
+	if !snapshot.LastTradeTime.IsZero() {
+		response.LastTradeTime = &snapshot.LastTradeTime
+	}
+	if !snapshot.UpdatedAt.IsZero() {
+		response.UpdatedAt = &snapshot.UpdatedAt
+	}
+	// windows only hold state of their own trades
+	if len(snapshot.Windows) > 0 {
+		response.Sequence = &SequenceResponse{
+			Gaps:       snapshot.Sequence.Gaps,
+			Duplicates: snapshot.Sequence.Duplicates,
+			OutOfOrder: snapshot.Sequence.OutOfOrder,
+		}
+	}
+	for _, window := range snapshot.Windows {
+		response.Windows = append(response.Windows, NewPairResponse(window))
+	}
+
+	return response
+}
+
+// writeJSON - writes value as JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Println("failed to write response:", err)
+	}
+}
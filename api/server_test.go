@@ -0,0 +1,116 @@
+package api
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"CoinbaseMatchesVWAP/utils"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createAggregator - creates an aggregator with 2 trading pairs for testing purposes, only BTC-USD has trades and a gap
+func createAggregator() *utils.Aggregator {
+	aggregator := utils.NewAggregator(model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-USD"},
+		SocketAddress: "test",
+		Window:        4,
+	})
+	at := time.Date(2021, 11, 11, 8, 35, 56, 0, time.UTC)
+	aggregator.AddAt("BTC-USD", 1, 2, at)
+	aggregator.AddAt("BTC-USD", 4, 1, at.Add(time.Second))
+	aggregator.CheckSequence(model.DataPoint{ProductID: "BTC-USD", Sequence: 10, TradeID: 1})
+	aggregator.CheckSequence(model.DataPoint{ProductID: "BTC-USD", Sequence: 12, TradeID: 3})
+	return aggregator
+}
+
+// TestServer_Start - tests that Start returns an error when address is already in use
+func TestServer_Start(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	server := NewServer(listener.Addr().String(), createAggregator(), StreamConfig{})
+	require.NotNil(t, server.Start())
+
+	server = NewServer("127.0.0.1:0", createAggregator(), StreamConfig{})
+	require.Nil(t, server.Start())
+	require.Nil(t, server.Shutdown(context.Background()))
+}
+
+// TestServer_VWAP - tests /vwap endpoint
+func TestServer_VWAP(t *testing.T) {
+	server := NewServer(":0", createAggregator(), StreamConfig{})
+	recorder := httptest.NewRecorder()
+
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vwap", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response []PairResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Len(t, response, 2)
+
+	btc := response[0]
+	require.Equal(t, "BTC-USD", btc.Pair)
+	require.Equal(t, 3.0, *btc.VWAP)
+	require.Equal(t, 2, btc.Trades)
+	require.Equal(t, 0.5, btc.WindowFill)
+	require.Equal(t, 1.0, *btc.MinPrice)
+	require.Equal(t, 4.0, *btc.MaxPrice)
+	require.Equal(t, 3.0, btc.CumulatedVolume)
+	require.Equal(t, time.Date(2021, 11, 11, 8, 35, 57, 0, time.UTC), *btc.LastTradeTime)
+	require.NotNil(t, btc.UpdatedAt)
+	require.Equal(t, &SequenceResponse{Gaps: 1}, btc.Sequence)
+	require.Len(t, btc.Windows, 1)
+	require.Equal(t, 4, btc.Windows[0].Window)
+	require.Nil(t, btc.Windows[0].Sequence)
+
+	// pair without trades has no VWAP
+	eth := response[1]
+	require.Equal(t, "ETH-USD", eth.Pair)
+	require.Nil(t, eth.VWAP)
+	require.Nil(t, eth.MinPrice)
+	require.Nil(t, eth.UpdatedAt)
+	require.Equal(t, &SequenceResponse{}, eth.Sequence)
+}
+
+// TestServer_PairVWAP - tests /vwap/{pair} endpoint
+func TestServer_PairVWAP(t *testing.T) {
+	server := NewServer(":0", createAggregator(), StreamConfig{})
+	recorder := httptest.NewRecorder()
+
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vwap/btc-usd", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response PairResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "BTC-USD", response.Pair)
+	require.Equal(t, 3.0, *response.VWAP)
+}
+
+// TestServer_PairVWAP_Unknown - tests /vwap/{pair} endpoint with a trading pair which is not configured
+func TestServer_PairVWAP_Unknown(t *testing.T) {
+	server := NewServer(":0", createAggregator(), StreamConfig{})
+	recorder := httptest.NewRecorder()
+
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vwap/DOGE-USD", nil))
+
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// TestServer_Metrics - tests that /metrics exposes gauges of configured trading pairs
+func TestServer_Metrics(t *testing.T) {
+	server := NewServer(":0", createAggregator(), StreamConfig{})
+	recorder := httptest.NewRecorder()
+
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `coinbase_vwap{pair="BTC-USD",window="4"} 3`+"\n")
+	require.Contains(t, recorder.Body.String(), `coinbase_vwap{pair="ETH-USD",window="4"} NaN`+"\n")
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"CoinbaseMatchesVWAP/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// StreamPolicyCoalesce - a slow client only receives the latest update of each trading pair
+	StreamPolicyCoalesce = "coalesce"
+	// StreamPolicyDrop - updates are queued per client, new updates are dropped while queue is full
+	StreamPolicyDrop = "drop"
+)
+
+// defaultStreamBuffer - size of client queues used by StreamPolicyDrop when not configured
+const defaultStreamBuffer = 256
+
+// streamWriteTimeout - maximum time to write updates to a websocket client
+const streamWriteTimeout = 10 * time.Second
+
+// StreamConfig - configures streaming of VWAP updates
+type StreamConfig struct {
+	// Policy - handling of clients slower than updates, StreamPolicyCoalesce (default) or StreamPolicyDrop
+	Policy string
+	// Buffer - size of client queue used by StreamPolicyDrop
+	Buffer int
+}
+
+// Broadcaster - fans out VWAP updates to streaming clients without ever blocking the publisher
+type Broadcaster struct {
+	mu          sync.Mutex
+	config      StreamConfig
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber - updates pending delivery to a single streaming client
+type subscriber struct {
+	mu sync.Mutex
+	// pairs - trading pairs client is interested in, all if empty
+	pairs  map[string]bool
+	policy string
+	buffer int
+	// queue - pending updates, in order of publishing
+	queue []utils.VWAPSnapshot
+	// notify - signals pending updates
+	notify chan struct{}
+	// dropped - number of updates dropped because queue was full
+	dropped int
+}
+
+// NewBroadcaster - initializes a new broadcaster
+func NewBroadcaster(config StreamConfig) *Broadcaster {
+	if config.Policy == "" {
+		config.Policy = StreamPolicyCoalesce
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = defaultStreamBuffer
+	}
+	return &Broadcaster{
+		config:      config,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// Publish - delivers an update to all subscribers interested in its trading pair
+func (b *Broadcaster) Publish(snapshot utils.VWAPSnapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		sub.push(snapshot)
+	}
+}
+
+// subscribe - registers a new subscriber for trading pairs (all if empty)
+func (b *Broadcaster) subscribe(pairs []string) *subscriber {
+	sub := &subscriber{
+		pairs:  map[string]bool{},
+		policy: b.config.Policy,
+		buffer: b.config.Buffer,
+		notify: make(chan struct{}, 1),
+	}
+	for _, pair := range pairs {
+		sub.pairs[pair] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe - removes a subscriber
+func (b *Broadcaster) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, sub)
+}
+
+// wants - reports whether subscriber is interested in trading pair
+func (sub *subscriber) wants(pair string) bool {
+	return len(sub.pairs) == 0 || sub.pairs[pair]
+}
+
+// push - queues an update according to slow consumer policy, never blocks
+func (sub *subscriber) push(snapshot utils.VWAPSnapshot) {
+	if !sub.wants(snapshot.Pair) {
+		return
+	}
+
+	sub.mu.Lock()
+	if sub.policy == StreamPolicyDrop {
+		if len(sub.queue) >= sub.buffer {
+			sub.dropped++
+			sub.mu.Unlock()
+			return
+		}
+		sub.queue = append(sub.queue, snapshot)
+	} else {
+		// replace pending update of same trading pair, if any
+		replaced := false
+		for i := range sub.queue {
+			if sub.queue[i].Pair == snapshot.Pair {
+				sub.queue[i] = snapshot
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			sub.queue = append(sub.queue, snapshot)
+		}
+	}
+	sub.mu.Unlock()
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain - takes all pending updates
+func (sub *subscriber) drain() []utils.VWAPSnapshot {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	queue := sub.queue
+	sub.queue = nil
+	return queue
+}
+
+// parsePairs - parses comma separated "pairs" query parameter
+func parsePairs(r *http.Request) []string {
+	var pairs []string
+	for _, pair := range strings.Split(r.URL.Query().Get("pairs"), ",") {
+		pair = strings.ToUpper(strings.TrimSpace(pair))
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// initialUpdates - current state of trading pairs subscriber is interested in, sent when client connects
+func (s *Server) initialUpdates(sub *subscriber) []utils.VWAPSnapshot {
+	var snapshots []utils.VWAPSnapshot
+	for _, snapshot := range s.aggregator.Snapshot() {
+		if sub.wants(snapshot.Pair) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// handleSSE - streams VWAP updates as server-sent events (/stream?pairs=BTC-USD,ETH-USD)
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "streaming not supported"})
+		return
+	}
+
+	sub := s.broadcaster.subscribe(parsePairs(r))
+	defer s.broadcaster.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	updates := s.initialUpdates(sub)
+	for {
+		for _, snapshot := range updates {
+			data, err := json.Marshal(NewPairResponse(snapshot))
+			if err != nil {
+				log.Println("failed to encode update:", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: vwap\ndata: %s\n\n", data)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-sub.notify:
+			updates = sub.drain()
+		}
+	}
+}
+
+// handleWebsocket - streams VWAP updates as websocket messages (/stream/ws?pairs=BTC-USD,ETH-USD)
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader already responded with an error
+		return
+	}
+	defer conn.Close()
+
+	sub := s.broadcaster.subscribe(parsePairs(r))
+	defer s.broadcaster.unsubscribe(sub)
+
+	// messages from client are discarded, reading only detects a closed connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	updates := s.initialUpdates(sub)
+	for {
+		for _, snapshot := range updates {
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			err = conn.WriteJSON(NewPairResponse(snapshot))
+			if err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-closed:
+			return
+		case <-s.closing:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+			return
+		case <-sub.notify:
+			updates = sub.drain()
+		}
+	}
+}
+
+// newUpgrader - websocket upgrader accepting any origin, API is read only
+func newUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+}
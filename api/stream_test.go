@@ -0,0 +1,122 @@
+package api
+
+import (
+	"CoinbaseMatchesVWAP/utils"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBroadcaster_Coalesce - tests that a slow client only keeps latest update of each trading pair
+func TestBroadcaster_Coalesce(t *testing.T) {
+	broadcaster := NewBroadcaster(StreamConfig{Policy: StreamPolicyCoalesce})
+	sub := broadcaster.subscribe(nil)
+
+	for i := 1; i <= 1000; i++ {
+		broadcaster.Publish(utils.VWAPSnapshot{Pair: "BTC-USD", Trades: i})
+		broadcaster.Publish(utils.VWAPSnapshot{Pair: "ETH-USD", Trades: i})
+	}
+
+	<-sub.notify
+	updates := sub.drain()
+	require.Len(t, updates, 2)
+	require.Equal(t, "BTC-USD", updates[0].Pair)
+	require.Equal(t, 1000, updates[0].Trades)
+	require.Equal(t, "ETH-USD", updates[1].Pair)
+	require.Equal(t, 1000, updates[1].Trades)
+}
+
+// TestBroadcaster_Drop - tests that updates are dropped once a slow client's queue is full
+func TestBroadcaster_Drop(t *testing.T) {
+	broadcaster := NewBroadcaster(StreamConfig{Policy: StreamPolicyDrop, Buffer: 10})
+	sub := broadcaster.subscribe([]string{"BTC-USD"})
+
+	for i := 1; i <= 100; i++ {
+		broadcaster.Publish(utils.VWAPSnapshot{Pair: "BTC-USD", Trades: i})
+		// filtered out
+		broadcaster.Publish(utils.VWAPSnapshot{Pair: "ETH-USD", Trades: i})
+	}
+
+	updates := sub.drain()
+	require.Len(t, updates, 10)
+	require.Equal(t, 1, updates[0].Trades)
+	require.Equal(t, 10, updates[9].Trades)
+	require.Equal(t, 90, sub.dropped)
+}
+
+// TestServer_SSE - tests streaming of updates as server-sent events
+func TestServer_SSE(t *testing.T) {
+	aggregator := createAggregator()
+	server := NewServer(":0", aggregator, StreamConfig{})
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	defer server.Shutdown(context.Background())
+
+	response, err := http.Get(httpServer.URL + "/stream?pairs=ETH-USD")
+	require.Nil(t, err)
+	defer response.Body.Close()
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+	readEvent := func() PairResponse {
+		var data string
+		for {
+			line, err := reader.ReadString('\n')
+			require.Nil(t, err)
+			if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+			}
+			if line == "\n" {
+				break
+			}
+		}
+		var event PairResponse
+		require.Nil(t, json.Unmarshal([]byte(data), &event))
+		return event
+	}
+
+	// current state is sent on connect
+	event := readEvent()
+	require.Equal(t, "ETH-USD", event.Pair)
+	require.Nil(t, event.VWAP)
+
+	// BTC-USD is filtered out
+	aggregator.AddAt("BTC-USD", 10, 1, time.Now())
+	aggregator.AddAt("ETH-USD", 2, 1, time.Now())
+
+	event = readEvent()
+	require.Equal(t, "ETH-USD", event.Pair)
+	require.Equal(t, 2.0, *event.VWAP)
+}
+
+// TestServer_Websocket - tests streaming of updates over websocket
+func TestServer_Websocket(t *testing.T) {
+	aggregator := createAggregator()
+	server := NewServer(":0", aggregator, StreamConfig{})
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	defer server.Shutdown(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/stream/ws?pairs=BTC-USD", nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	var event PairResponse
+	require.Nil(t, conn.ReadJSON(&event))
+	require.Equal(t, "BTC-USD", event.Pair)
+	require.Equal(t, 2, event.Trades)
+
+	aggregator.AddAt("BTC-USD", 7, 1, time.Now())
+
+	require.Nil(t, conn.ReadJSON(&event))
+	require.Equal(t, "BTC-USD", event.Pair)
+	require.Equal(t, 3, event.Trades)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/metrics"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// QuarantinedFrame - models a single line of the quarantine file, a frame which could not be processed and why
+type QuarantinedFrame struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	Frame string    `json:"frame"`
+}
+
+// deadLetters - collects frames which could not be processed, so reading can continue without them.
+// Frames are counted, logged and written to an optional quarantine file.
+type deadLetters struct {
+	mu sync.Mutex
+	// threshold - number of dead letters after which the feed is considered broken, 0 never considers it broken
+	threshold int
+	count     int
+	// file and encoder - optional quarantine file, frames are appended to it
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// newDeadLetters - initializes dead letters, appending them to quarantine file at path unless path is empty
+func newDeadLetters(path string, threshold int) (*deadLetters, error) {
+	d := &deadLetters{threshold: threshold}
+	if path == "" {
+		return d, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.file = file
+	d.encoder = json.NewEncoder(file)
+	return d, nil
+}
+
+// Add - records a frame which could not be processed.
+// Returns an error once the number of dead letters exceeds threshold.
+func (d *deadLetters) Add(frame []byte, reason error) error {
+	metrics.ParseFailures.Inc()
+	log.Printf("dead letter: err=%q frame=%q", reason, frame)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count++
+	if d.encoder != nil {
+		err := d.encoder.Encode(QuarantinedFrame{Time: time.Now().UTC(), Error: reason.Error(), Frame: string(frame)})
+		if err != nil {
+			log.Println("failed to quarantine:", err)
+		}
+	}
+
+	if d.threshold > 0 && d.count > d.threshold {
+		return fmt.Errorf("feed considered broken after %d invalid messages, latest: %v", d.count, reason)
+	}
+	return nil
+}
+
+// Count - returns number of dead letters recorded
+func (d *deadLetters) Count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+// Close - closes quarantine file, if any
+func (d *deadLetters) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDeadLetters_Quarantine - tests that dead letters are appended to quarantine file with their reason
+func TestDeadLetters_Quarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.jsonl")
+
+	// quarantine file is appended to, so frames of previous runs are kept
+	for i := 0; i < 2; i++ {
+		dead, err := newDeadLetters(path, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		err = dead.Add([]byte(`invalid message`), errors.New("invalid message"))
+		if err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+		dead.Close()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer file.Close()
+
+	var frames []QuarantinedFrame
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var frame QuarantinedFrame
+		err = json.Unmarshal(scanner.Bytes(), &frame)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("expected %d quarantined frames got %d", 2, len(frames))
+	}
+	if frames[0].Frame != "invalid message" || frames[0].Error != "invalid message" || frames[0].Time.IsZero() {
+		t.Errorf("expected frame %q with reason and time got %+v", "invalid message", frames[0])
+	}
+}
+
+// TestDeadLetters_Threshold - tests that an error is returned once dead letters exceed threshold
+func TestDeadLetters_Threshold(t *testing.T) {
+	dead, err := newDeadLetters("", 1)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer dead.Close()
+
+	if err = dead.Add([]byte(`{`), errors.New("unexpected end of JSON input")); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	if err = dead.Add([]byte(`{`), errors.New("unexpected end of JSON input")); err == nil {
+		t.Error("expected feed considered broken error, got nil")
+	}
+	if dead.Count() != 2 {
+		t.Errorf("expected %d dead letters got %d", 2, dead.Count())
+	}
+}
@@ -0,0 +1,216 @@
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode - defines how digits beyond scale are rounded
+type RoundingMode int
+
+const (
+	// RoundHalfEven - rounds to nearest, ties to even digit (banker's rounding)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp - rounds to nearest, ties away from zero
+	RoundHalfUp
+	// RoundDown - truncates towards zero
+	RoundDown
+)
+
+// ParseRoundingMode - parses name of a rounding mode ("half_even", "half_up" or "down")
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	switch strings.ToLower(name) {
+	case "", "half_even":
+		return RoundHalfEven, nil
+	case "half_up":
+		return RoundHalfUp, nil
+	case "down":
+		return RoundDown, nil
+	}
+	return RoundHalfEven, fmt.Errorf("unknown rounding mode %q", name)
+}
+
+// Decimal - immutable arbitrary precision decimal number, represented as unscaled * 10^-scale.
+// Zero value is 0.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+// zero - shared unscaled value of zero value, must not be modified
+var zero = new(big.Int)
+
+// powers - cache of small powers of ten, must not be modified
+var powers = func() []*big.Int {
+	result := make([]*big.Int, 40)
+	result[0] = big.NewInt(1)
+	for i := 1; i < len(result); i++ {
+		result[i] = new(big.Int).Mul(result[i-1], big.NewInt(10))
+	}
+	return result
+}()
+
+// pow10 - returns 10^n, must not be modified
+func pow10(n int32) *big.Int {
+	if int(n) < len(powers) {
+		return powers[n]
+	}
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Parse - parses a plain decimal string such as "64632.95" or "-0.00002416"
+func Parse(value string) (Decimal, error) {
+	digits := value
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	}
+
+	var scale int32
+	dot := strings.IndexByte(digits, '.')
+	if dot >= 0 {
+		scale = int32(len(digits) - dot - 1)
+		digits = digits[:dot] + digits[dot+1:]
+	}
+	if digits == "" || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return Decimal{}, errors.New("invalid decimal: " + strconv.Quote(value))
+	}
+
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(value, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return Decimal{unscaled: unscaled, scale: scale}, nil
+}
+
+// NewFromInt - creates a decimal from an integer
+func NewFromInt(value int64) Decimal {
+	return Decimal{unscaled: big.NewInt(value)}
+}
+
+// NewFromFloat - creates a decimal from the shortest decimal representation of a float
+func NewFromFloat(value float64) Decimal {
+	result, err := Parse(strconv.FormatFloat(value, 'f', -1, 64))
+	if err != nil {
+		// NaN and infinities have no decimal representation
+		return Decimal{}
+	}
+	return result
+}
+
+// int - returns unscaled value, treating zero value as 0
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return zero
+	}
+	return d.unscaled
+}
+
+// rescale - returns unscaled value of d at a greater or equal scale
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.int()
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// align - returns unscaled values of a and b at common scale
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	if a.scale >= b.scale {
+		return a.int(), b.rescale(a.scale), a.scale
+	}
+	return a.rescale(b.scale), b.int(), b.scale
+}
+
+// Add - returns d + other
+func (d Decimal) Add(other Decimal) Decimal {
+	a, b, scale := align(d, other)
+	return Decimal{unscaled: new(big.Int).Add(a, b), scale: scale}
+}
+
+// Sub - returns d - other
+func (d Decimal) Sub(other Decimal) Decimal {
+	a, b, scale := align(d, other)
+	return Decimal{unscaled: new(big.Int).Sub(a, b), scale: scale}
+}
+
+// Mul - returns d * other
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), other.int()), scale: d.scale + other.scale}
+}
+
+// Div - returns d / other, rounded to scale digits after decimal point. Panics if other is 0.
+func (d Decimal) Div(other Decimal, scale int32, mode RoundingMode) Decimal {
+	// d / other = (d.unscaled * 10^(other.scale + scale)) / (other.unscaled * 10^d.scale) * 10^-scale
+	numerator := new(big.Int).Mul(d.int(), pow10(other.scale+scale))
+	denominator := new(big.Int).Mul(other.int(), pow10(d.scale))
+	return Decimal{unscaled: roundQuo(numerator, denominator, mode), scale: scale}
+}
+
+// Round - returns d rounded to scale digits after decimal point
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{unscaled: d.rescale(scale), scale: scale}
+	}
+	return Decimal{unscaled: roundQuo(d.int(), pow10(d.scale-scale), mode), scale: scale}
+}
+
+// roundQuo - returns numerator / denominator, rounded to an integer
+func roundQuo(numerator, denominator *big.Int, mode RoundingMode) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if remainder.Sign() == 0 || mode == RoundDown {
+		return quotient
+	}
+
+	// compare twice the remainder with the denominator to find out whether the remainder is past half
+	double := new(big.Int).Abs(remainder)
+	double.Lsh(double, 1)
+	comparison := double.Cmp(new(big.Int).Abs(denominator))
+	if comparison > 0 || (comparison == 0 && (mode == RoundHalfUp || quotient.Bit(0) == 1)) {
+		// round away from zero
+		if numerator.Sign()*denominator.Sign() < 0 {
+			quotient.Sub(quotient, powers[0])
+		} else {
+			quotient.Add(quotient, powers[0])
+		}
+	}
+	return quotient
+}
+
+// Cmp - returns -1, 0 or 1 if d is less than, equal to or greater than other
+func (d Decimal) Cmp(other Decimal) int {
+	a, b, _ := align(d, other)
+	return a.Cmp(b)
+}
+
+// Sign - returns -1, 0 or 1 if d is negative, zero or positive
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// Float64 - returns nearest float to d
+func (d Decimal) Float64() float64 {
+	result, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return result
+}
+
+// String - formats d with all of its digits after decimal point
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits
+	}
+
+	// pad with leading zeros, so there is at least one digit before decimal point
+	if len(digits) <= int(d.scale) {
+		digits = strings.Repeat("0", int(d.scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
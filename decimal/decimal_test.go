@@ -0,0 +1,105 @@
+package decimal
+
+import "testing"
+
+// mustParse - parses a decimal for testing purposes
+func mustParse(t *testing.T, value string) Decimal {
+	result, err := Parse(value)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", value, err)
+	}
+	return result
+}
+
+// TestParse - tests parsing and formatting round trip
+func TestParse(t *testing.T) {
+	for _, value := range []string{"64632.95", "0.00002416", "-1.5", "12", "0.0", "-0.001"} {
+		result := mustParse(t, value)
+		if result.String() != value {
+			t.Errorf("expected %s got %s", value, result.String())
+		}
+	}
+
+	for _, value := range []string{"", "-", "abc", "1.2.3", "1e5", "NaN"} {
+		_, err := Parse(value)
+		if err == nil {
+			t.Errorf("expected error parsing %q", value)
+		}
+	}
+}
+
+// TestDecimal_Arithmetic - tests Add, Sub and Mul
+func TestDecimal_Arithmetic(t *testing.T) {
+	a := mustParse(t, "0.1")
+	b := mustParse(t, "0.2")
+
+	if a.Add(b).String() != "0.3" {
+		t.Errorf("expected %s got %s", "0.3", a.Add(b))
+	}
+	if a.Sub(b).String() != "-0.1" {
+		t.Errorf("expected %s got %s", "-0.1", a.Sub(b))
+	}
+	if a.Mul(b).String() != "0.02" {
+		t.Errorf("expected %s got %s", "0.02", a.Mul(b))
+	}
+	if a.Add(b).Cmp(mustParse(t, "0.30000")) != 0 {
+		t.Error("expected 0.3 to equal 0.30000")
+	}
+
+	var zero Decimal
+	if zero.Add(a).String() != "0.1" || zero.Sign() != 0 {
+		t.Error("expected zero value to be 0")
+	}
+}
+
+// TestDecimal_Div - tests division with each rounding mode
+func TestDecimal_Div(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		scale    int32
+		mode     RoundingMode
+		expected string
+	}{
+		{"10", "3", 4, RoundHalfEven, "3.3333"},
+		{"20", "3", 4, RoundHalfEven, "6.6667"},
+		{"20", "3", 4, RoundDown, "6.6666"},
+		{"-20", "3", 4, RoundHalfUp, "-6.6667"},
+		// ties
+		{"0.125", "1", 2, RoundHalfEven, "0.12"},
+		{"0.125", "1", 2, RoundHalfUp, "0.13"},
+		{"0.135", "1", 2, RoundHalfEven, "0.14"},
+		{"-0.125", "1", 2, RoundHalfUp, "-0.13"},
+		{"64632.95", "0.00002416", 2, RoundHalfEven, "2675204884.11"},
+	}
+
+	for _, c := range cases {
+		result := mustParse(t, c.a).Div(mustParse(t, c.b), c.scale, c.mode)
+		if result.String() != c.expected {
+			t.Errorf("%s / %s: expected %s got %s", c.a, c.b, c.expected, result)
+		}
+	}
+}
+
+// TestDecimal_Round - tests rounding to a lower and a higher scale
+func TestDecimal_Round(t *testing.T) {
+	value := mustParse(t, "2.345")
+	if value.Round(2, RoundHalfUp).String() != "2.35" {
+		t.Errorf("expected %s got %s", "2.35", value.Round(2, RoundHalfUp))
+	}
+	if value.Round(2, RoundHalfEven).String() != "2.34" {
+		t.Errorf("expected %s got %s", "2.34", value.Round(2, RoundHalfEven))
+	}
+	if value.Round(5, RoundDown).String() != "2.34500" {
+		t.Errorf("expected %s got %s", "2.34500", value.Round(5, RoundDown))
+	}
+}
+
+// TestDecimal_Float64 - tests conversion from and to floats
+func TestDecimal_Float64(t *testing.T) {
+	if mustParse(t, "0.00002416").Float64() != 0.00002416 {
+		t.Errorf("expected %v got %v", 0.00002416, mustParse(t, "0.00002416").Float64())
+	}
+	if NewFromFloat(64632.95).String() != "64632.95" {
+		t.Errorf("expected %s got %s", "64632.95", NewFromFloat(64632.95))
+	}
+}
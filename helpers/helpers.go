@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"CoinbaseMatchesVWAP/model"
+	"encoding/json"
 	"fmt"
 	"math"
 	"strings"
@@ -26,6 +28,16 @@ func GetSubscribeToMatchesMessage(pairs []string) string {
 `, strings.Join(wrappedPairs, ","))
 }
 
+// GetSubscriptionMessage builds a subscribe or unsubscribe message (model.TypeSubscribe, model.TypeUnsubscribe) for channels
+func GetSubscriptionMessage(messageType string, channels []model.Channel) string {
+	// marshaling strings and slices of strings can't fail
+	message, _ := json.Marshal(model.SubscriptionMessage{
+		Type:     messageType,
+		Channels: channels,
+	})
+	return string(message)
+}
+
 // GetMaxFloat - returns maximum in float64 slice
 func GetMaxFloat(vals []float64) float64 {
 	var max float64
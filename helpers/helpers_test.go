@@ -1,6 +1,9 @@
 package helpers
 
-import "testing"
+import (
+	"CoinbaseMatchesVWAP/model"
+	"testing"
+)
 
 func TestGetSubscribeToMatchesMessage(t *testing.T) {
 	expectedResult := `
@@ -21,6 +24,18 @@ func TestGetSubscribeToMatchesMessage(t *testing.T) {
 	}
 }
 
+func TestGetSubscriptionMessage(t *testing.T) {
+	expectedResult := `{"type":"subscribe","channels":[{"name":"matches","product_ids":["BTC-USD","ETH-USD"]},{"name":"heartbeat","product_ids":["BTC-USD"]}]}`
+	channels := []model.Channel{
+		{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD", "ETH-USD"}},
+		{Name: model.ChannelHeartbeat, ProductIDs: []string{"BTC-USD"}},
+	}
+	result := GetSubscriptionMessage(model.TypeSubscribe, channels)
+	if result != expectedResult {
+		t.Errorf("got %s, expected %s", result, expectedResult)
+	}
+}
+
 func TestGetMaxFloat(t *testing.T) {
 	floats := []float64{1.23, 32, 1, 4, 2.32}
 	result := GetMaxFloat(floats)
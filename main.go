@@ -1,10 +1,13 @@
 package main
 
 import (
-	"CoinbaseMatchesVWAP/helpers"
+	"CoinbaseMatchesVWAP/api"
+	"CoinbaseMatchesVWAP/decimal"
+	"CoinbaseMatchesVWAP/metrics"
 	"CoinbaseMatchesVWAP/model"
 	"CoinbaseMatchesVWAP/utils"
 	"CoinbaseMatchesVWAP/websocketClient"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -12,17 +15,33 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// configPath - configuration file, reloaded while running when changed
+const configPath = "conf.json"
+
+// staleCheckInterval - interval trading pairs are checked for staleness
+const staleCheckInterval = time.Second
+
+// subscribeTimeout - maximum time to wait on start for server to acknowledge or reject subscribed trading pairs
+const subscribeTimeout = 10 * time.Second
+
+// shutdownTimeout - maximum time to wait on shutdown for HTTP connections to finish
+const shutdownTimeout = 5 * time.Second
+
 // loads configuration from JSON file
-func loadConfig() (model.Config, error) {
-	file, _ := os.Open("conf.json")
+func loadConfig(path string) (model.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return model.Config{}, err
+	}
 	defer file.Close()
 	decoder := json.NewDecoder(file)
 	configuration := model.Config{}
-	err := decoder.Decode(&configuration)
+	err = decoder.Decode(&configuration)
 	if err != nil {
 		return model.Config{}, err
 	}
@@ -30,23 +49,202 @@ func loadConfig() (model.Config, error) {
 	return configuration, nil
 }
 
-// validateConfig validates a configuration
+// configErrors - all problems found while validating a configuration
+type configErrors []error
+
+// Error - lists all problems, one per line
+func (e configErrors) Error() string {
+	var messages []string
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// validateConfig validates a configuration, reporting all problems at once
 func validateConfig(config model.Config) error {
-	if len(config.TradePairs) == 0 {
-		return errors.New("No TRADE_PAIRS in configuration")
+	var errs configErrors
+
+	if len(config.GetTradePairs()) == 0 {
+		errs = append(errs, errors.New("No TRADE_PAIRS in configuration"))
+	}
+	// socket address is not used when replaying a recording
+	if config.SocketAddress == "" && config.ReplayFile == "" {
+		errs = append(errs, errors.New("No SOCKET_ADDRESS in configuration"))
+	}
+	if config.ReplaySpeed < 0 {
+		errs = append(errs, errors.New("REPLAY_SPEED in configuration must not be negative"))
+	}
+	switch config.SequencePolicy {
+	case "", utils.SequencePolicyIgnore, utils.SequencePolicyLog, utils.SequencePolicyDegrade, utils.SequencePolicyResubscribe:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid SEQUENCE_POLICY %q in configuration", config.SequencePolicy))
+	}
+
+	switch config.UnknownProductPolicy {
+	case "", utils.UnknownProductDrop, utils.UnknownProductCreate, utils.UnknownProductError:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid UNKNOWN_PRODUCT_POLICY %q in configuration", config.UnknownProductPolicy))
 	}
-	if config.SocketAddress == "" {
-		return errors.New("No SOCKET_ADDRESS in configuration")
+
+	switch config.OverflowPolicy {
+	case "", overflowBlock, overflowDropNewest, overflowDropOldest:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid OVERFLOW_POLICY %q in configuration", config.OverflowPolicy))
+	}
+	if config.QueueSize < 0 {
+		errs = append(errs, errors.New("QUEUE_SIZE in configuration must not be negative"))
+	}
+
+	switch config.OutputMode {
+	case "", outputEvery, outputInterval, outputThreshold:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid OUTPUT_MODE %q in configuration", config.OutputMode))
+	}
+	if config.OutputInterval < 0 || config.OutputThreshold < 0 {
+		errs = append(errs, errors.New("OUTPUT_INTERVAL and OUTPUT_THRESHOLD in configuration must not be negative"))
 	}
-	if config.Window == 0 {
-		return errors.New("No WINDOW in configuration")
+
+	switch config.StreamPolicy {
+	case "", api.StreamPolicyCoalesce, api.StreamPolicyDrop:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid STREAM_POLICY %q in configuration", config.StreamPolicy))
+	}
+
+	for _, channel := range config.Channels {
+		if !model.IsKnownChannel(channel) {
+			errs = append(errs, fmt.Errorf("Invalid channel %q in CHANNELS in configuration", channel))
+		}
+	}
+
+	switch config.StalePolicy {
+	case "", utils.StalePolicyLog, utils.StalePolicyReconnect:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid STALE_POLICY %q in configuration", config.StalePolicy))
+	}
+	if config.HeartbeatTimeout < 0 {
+		errs = append(errs, errors.New("HEARTBEAT_TIMEOUT in configuration must not be negative"))
+	}
+	if config.StaleAfter < 0 {
+		errs = append(errs, errors.New("STALE_AFTER in configuration must not be negative"))
+	}
+
+	if config.DeadLetterThreshold < 0 {
+		errs = append(errs, errors.New("DEAD_LETTER_THRESHOLD in configuration must not be negative"))
+	}
+
+	if config.GetDecimalScale() < 0 {
+		errs = append(errs, errors.New("DECIMAL_SCALE in configuration must not be negative"))
+	}
+	_, err := decimal.ParseRoundingMode(config.DecimalRounding)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Invalid DECIMAL_ROUNDING in configuration: %v", err))
+	}
+
+	// validate effective settings of each enabled trading pair
+	for _, pair := range config.GetTradePairs() {
+		errs = append(errs, validatePairConfig(pair, config.ForPair(pair))...)
+	}
+
+	if len(errs) > 0 {
+		return errs
 	}
 	return nil
 }
 
+// socketOptions - returns options of websocket client connecting to address, either a host (connected to with wss) or a ws:// or wss:// URL
+func socketOptions(address string) websocketClient.ClientOptions {
+	if strings.Contains(address, "://") {
+		return websocketClient.ClientOptions{URL: address}
+	}
+	return websocketClient.ClientOptions{Address: address}
+}
+
+// keepalivePolicy - returns keepalive of websocket connection, with defaults for durations not configured
+// and checks configured with a negative duration disabled
+func keepalivePolicy(config model.Config) websocketClient.KeepalivePolicy {
+	policy := websocketClient.DefaultKeepalivePolicy
+	policy.PingInterval = keepaliveDuration(config.PingInterval, policy.PingInterval)
+	policy.PongTimeout = keepaliveDuration(config.PongTimeout, policy.PongTimeout)
+	policy.ReadTimeout = keepaliveDuration(config.ReadTimeout, policy.ReadTimeout)
+	policy.WriteTimeout = keepaliveDuration(config.WriteTimeout, policy.WriteTimeout)
+	return policy
+}
+
+// keepaliveDuration - returns configured keepalive duration, fallback if not set, 0 (disabled) if negative
+func keepaliveDuration(configured model.Duration, fallback time.Duration) time.Duration {
+	switch {
+	case configured < 0:
+		return 0
+	case configured == 0:
+		return fallback
+	default:
+		return time.Duration(configured)
+	}
+}
+
+// reconnectPolicy - returns reconnect policy of websocket client, counting attempts and failures in metrics
+func reconnectPolicy() *websocketClient.ReconnectPolicy {
+	policy := websocketClient.DefaultReconnectPolicy
+	policy.OnReconnect = func(event websocketClient.ReconnectEvent) {
+		metrics.ReconnectAttempts.Inc()
+		if event.Err != nil {
+			metrics.ReconnectFailures.Inc()
+		}
+	}
+	return &policy
+}
+
+// validatePairConfig validates effective settings of a trading pair
+func validatePairConfig(pair string, pairConfig model.PairConfig) []error {
+	var errs []error
+	for _, window := range pairConfig.Windows {
+		switch window.WindowType {
+		case model.WindowTypeTrades:
+			if window.Window <= 0 {
+				errs = append(errs, fmt.Errorf("No WINDOW in configuration for %s", pair))
+			}
+		case model.WindowTypeTime:
+			if window.WindowDuration <= 0 {
+				errs = append(errs, fmt.Errorf("No WINDOW_DURATION in configuration for %s", pair))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("Invalid WINDOW_TYPE %q in configuration for %s", window.WindowType, pair))
+		}
+	}
+	if pairConfig.CalculationMode != model.CalculationModeTypical && pairConfig.CalculationMode != model.CalculationModeStandard {
+		errs = append(errs, fmt.Errorf("Invalid CALCULATION_MODE %q in configuration for %s", pairConfig.CalculationMode, pair))
+	}
+	if pairConfig.GetPrecision() < 0 {
+		errs = append(errs, fmt.Errorf("PRECISION in configuration for %s must not be negative", pair))
+	}
+	if pairConfig.AlertAbove != nil && pairConfig.AlertBelow != nil && *pairConfig.AlertBelow >= *pairConfig.AlertAbove {
+		errs = append(errs, fmt.Errorf("ALERT_BELOW in configuration for %s must be lower than ALERT_ABOVE", pair))
+	}
+	return errs
+}
+
+// flags - command line flags of app
+type flags struct {
+	// addr - websocket address, overrides SOCKET_ADDRESS of configuration when set
+	addr string
+}
+
+// parseFlags - defines and parses command line flags of app
+func parseFlags(flagSet *flag.FlagSet, args []string) (flags, error) {
+	var result flags
+	flagSet.StringVar(&result.addr, "addr", "", "websocket service address, SOCKET_ADDRESS of configuration if not set")
+	err := flagSet.Parse(args)
+	return result, err
+}
+
 func main() {
+	// invalid flags exit with usage
+	cmdFlags, _ := parseFlags(flag.CommandLine, os.Args[1:])
+	log.SetFlags(0)
+
 	// load configuration
-	config, err := loadConfig()
+	config, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Println(fmt.Sprintf("Failed to load configuration. err: %v", err))
 		return
@@ -58,94 +256,287 @@ func main() {
 		return
 	}
 
-	socketAddr := flag.String("addr", config.SocketAddress, "http service address")
-	if socketAddr == nil {
-		fmt.Println(fmt.Sprintf("Websocket address not configured. err: %v", err))
-		return
+	socketAddr := cmdFlags.addr
+	if socketAddr == "" {
+		socketAddr = config.SocketAddress
 	}
 
-	// channel that handles shutdown
+	// shutdown on interrupt or SIGTERM, or once any part of the pipeline stops
+	group := newSupervisor(context.Background())
+	ctx := group.Context()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	// channel closed by client once it stopped reading
 	done := make(chan struct{})
-	// channel that handles read from websocket client
+	// channel that handles read from websocket client, closed by client once it stopped reading
 	read := make(chan []byte)
 
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-
 	// initialize an VWAP Utility for each trading pair
 	aggregator := utils.NewAggregator(config)
 
-	// initialize websocket client
-	client, err := websocketClient.NewSocketClient(socketAddr, done)
+	// initialize websocket client, or replay a recording instead if configured so
+	var client websocketClient.SocketClient
+	if config.ReplayFile != "" {
+		client, err = websocketClient.NewReplayClient(config.ReplayFile, config.ReplaySpeed, done)
+	} else {
+		options := socketOptions(socketAddr)
+		options.Reconnect = reconnectPolicy()
+		client, err = websocketClient.NewSocketClient(ctx, options, done)
+	}
 	if err != nil {
 		fmt.Println(fmt.Sprintf("Failed to open socket client: %v", err))
 		return
 	}
-	// subscribe to matches channel for all trading pairs
-	err = client.SubscribeToMatches(helpers.GetSubscribeToMatchesMessage(config.TradePairs))
+
+	// detect dead connections with pings and deadlines
+	client.SetKeepalive(keepalivePolicy(config))
+
+	// record raw frames if configured so, flushed on exit
+	if config.RecordFile != "" {
+		recorder, err := websocketClient.NewRecorder(config.RecordFile)
+		if err != nil {
+			fmt.Println(fmt.Sprintf("Failed to open recording file: %v", err))
+			return
+		}
+		defer recorder.Close()
+		client.SetRecorder(recorder)
+	}
+
+	// skip messages which can't be parsed, quarantining them if configured so
+	dead, err := newDeadLetters(config.QuarantineFile, config.DeadLetterThreshold)
+	if err != nil {
+		fmt.Println(fmt.Sprintf("Failed to open quarantine file: %v", err))
+		return
+	}
+	defer dead.Close()
+
+	// subscribe to matches channel, and other configured channels, for all trading pairs
+	err = client.Subscribe(config.GetChannels()...)
 	if err != nil {
 		fmt.Println(fmt.Sprintf("Failed to subscribe client to matches channel: %v", err))
 		return
 	}
-	// start reading from websocket
-	client.Read(read)
+	// sequence gaps and stale trading pairs may trigger a resubscribe, depending on SEQUENCE_POLICY and STALE_POLICY
+	aggregator.OnResubscribe = func(pair string) {
+		log.Printf("resubscribing after sequence gap or staleness in %s", pair)
+		err := client.Resubscribe()
+		if err != nil {
+			log.Printf("failed to resubscribe: %v", err)
+		}
+	}
+
+	// expose VWAP over HTTP if configured so
+	if config.HTTPAddress != "" {
+		server := api.NewServer(config.HTTPAddress, aggregator, api.StreamConfig{
+			Policy: config.StreamPolicy,
+			Buffer: config.StreamBuffer,
+		})
+		err = server.Start()
+		if err != nil {
+			fmt.Println(fmt.Sprintf("Failed to start HTTP API: %v", err))
+			return
+		}
+		group.Go("http", func(ctx context.Context) error {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			return server.Shutdown(shutdownCtx)
+		})
+	}
 
-	// start reading from channel
-	go startRead(read, aggregator, done)
+	// apply changes of configuration file, or on SIGHUP, while running
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	watcher := newConfigWatcher(configPath, config, func(previous, next model.Config) {
+		applyConfig(previous, next, aggregator, client)
+	})
+	group.Go("config watcher", func(ctx context.Context) error {
+		watcher.run(hup, ctx.Done())
+		return nil
+	})
 
-	// listen for shutdown events (keyboard interrupt or done)
-	for {
+	// start reading from websocket, closing it on shutdown
+	client.Read(read)
+	group.Go("client", func(ctx context.Context) error {
 		select {
 		case <-done:
-			return
-		case <-interrupt:
-			log.Println("interrupt")
-
+			// a replay stops once recording is finished, a connection only once reconnecting failed
+			if config.ReplayFile == "" {
+				return errors.New("websocket client stopped reading")
+			}
+			return nil
+		case <-ctx.Done():
 			client.Close()
+			<-done
+			return nil
+		}
+	})
 
-			select {
-			case <-done:
-			case <-time.After(time.Second):
+	// start reading from channel, until client closed it
+	group.Go("reader", func(ctx context.Context) error {
+		err := startRead(read, newPipeline(aggregator, dead, config.QueueSize, config.OverflowPolicy))
+		if err != nil {
+			// keep draining, so client is not blocked while it stops
+			group.Stop(err)
+			for range read {
 			}
-			return
+		}
+		return err
+	})
+
+	// print all Trading Pairs data using aggregator, at configured cadence
+	printer := newOutput(config.OutputMode, time.Duration(config.OutputInterval), config.OutputThreshold, aggregator.ToOutput)
+	aggregator.OnUpdate(printer.Update)
+	group.Go("output", func(ctx context.Context) error {
+		printer.run(ctx.Done())
+		return nil
+	})
+
+	// report stale trading pairs, reconnecting if configured so
+	group.Go("staleness monitor", func(ctx context.Context) error {
+		monitorStaleness(aggregator, ctx.Done())
+		return nil
+	})
+
+	// listen for shutdown signals
+	group.Go("signals", func(ctx context.Context) error {
+		select {
+		case sig := <-signals:
+			log.Printf("received %s, shutting down", sig)
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	// fail fast if server rejects a configured trading pair, recordings are not checked.
+	// Waiting stops early on shutdown.
+	if config.ReplayFile == "" {
+		pending, err := aggregator.Status.WaitSubscribed(ctx, subscribeTimeout)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			group.Stop(fmt.Errorf("Failed to subscribe: %w", err))
+		case len(pending) > 0:
+			log.Printf("subscription not acknowledged yet: product_ids=%v", pending)
 		}
 	}
+
+	// wait until all tasks stopped, after all in-flight messages were processed
+	err = group.Wait()
+	log.Println(summary(aggregator))
+	if err != nil {
+		fmt.Println(fmt.Sprintf("Stopped: %v", err))
+	}
 }
 
-// startRead - starts reading from input channel, outputs data to aggregator
-func startRead(read chan []byte, aggregator *utils.Aggregator, done chan struct{}) {
-	defer close(done)
-	var err error
-	for {
-		select {
-		case message := <-read:
-			var dataPoint model.DataPoint
-			err = json.Unmarshal(message, &dataPoint)
+// summary - returns final report of messages processed, and latest VWAP of all trading pairs
+func summary(aggregator *utils.Aggregator) string {
+	var dropped uint64
+	for _, count := range aggregator.Dropped() {
+		dropped += count
+	}
+	return fmt.Sprintf("summary: messages_received=%d messages_parsed=%d messages_ignored=%d parse_failures=%d error_messages=%d unknown_product_trades_dropped=%d reconnect_attempts=%d\n%s",
+		metrics.MessagesReceived.Value(), metrics.MessagesParsed.Value(), metrics.MessagesIgnored.Value(),
+		metrics.ParseFailures.Value(), metrics.ErrorMessages.Value(), dropped, metrics.ReconnectAttempts.Value(), aggregator.ToString())
+}
+
+// startRead - reads messages from read channel until it is closed, and routes matches to workers of pipeline.
+// Messages which can't be parsed are skipped as dead letters, returns an error once there are too many of them.
+// Returns after all queued matches were processed.
+func startRead(read chan []byte, p *pipeline) (err error) {
+	defer func() {
+		closeErr := p.close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	for message := range read {
+		metrics.MessagesReceived.Inc()
+		var dataPoint model.DataPoint
+		err = json.Unmarshal(message, &dataPoint)
+		if err != nil {
+			err = p.dead.Add(message, fmt.Errorf("invalid message: %w", err))
 			if err != nil {
-				return
+				return err
 			}
+			continue
+		}
 
-			// ignore messages other than matches
-			if dataPoint.Type != "last_match" && dataPoint.Type != "match" {
-				continue
+		// messages other than matches are not aggregated
+		if !dataPoint.IsMatch() {
+			metrics.MessagesIgnored.Inc()
+			handleMessage(dataPoint.Type, message, p.aggregator)
+			// matches of a new subscription, e.g. after reconnecting, don't continue sequence of previous ones
+			if dataPoint.Type == model.TypeSubscriptions {
+				p.rebaseline()
 			}
+			continue
+		}
+		p.aggregator.Status.Matched(dataPoint.ProductID, dataPoint.TradeID)
+		p.dispatch(match{dataPoint: dataPoint, message: message})
 
-			// parse price and volume of transaction (size)
-			price, err := strconv.ParseFloat(dataPoint.Price, 64)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
-			size, err := strconv.ParseFloat(dataPoint.Size, 64)
-			if err != nil {
-				fmt.Println(err)
-				return
+		// stop once a worker failed
+		err = p.err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleMessage - handles a message other than a match, based on its type
+func handleMessage(messageType string, message []byte, aggregator *utils.Aggregator) {
+	switch messageType {
+	case model.TypeSubscriptions:
+		var subscriptions model.SubscriptionMessage
+		err := json.Unmarshal(message, &subscriptions)
+		if err != nil {
+			log.Printf("invalid message: type=%s err=%v", messageType, err)
+			return
+		}
+		for _, channel := range subscriptions.Channels {
+			log.Printf("subscribed: channel=%s product_ids=%v", channel.Name, channel.ProductIDs)
+			if channel.Name == model.ChannelMatches {
+				aggregator.Status.Subscribed(channel.ProductIDs)
 			}
+		}
+	case model.TypeError:
+		metrics.ErrorMessages.Inc()
+		var errorMessage model.ErrorMessage
+		err := json.Unmarshal(message, &errorMessage)
+		if err != nil {
+			log.Printf("invalid message: type=%s err=%v", messageType, err)
+			return
+		}
+		rejected := aggregator.Status.Rejected(errorMessage.Message + ": " + errorMessage.Reason)
+		log.Printf("server error: message=%q reason=%q rejected_pairs=%v", errorMessage.Message, errorMessage.Reason, rejected)
+	case model.TypeHeartbeat:
+		var heartbeat model.Heartbeat
+		err := json.Unmarshal(message, &heartbeat)
+		if err != nil {
+			log.Printf("invalid message: type=%s err=%v", messageType, err)
+			return
+		}
+		aggregator.Status.Heartbeat(heartbeat)
+	case model.TypeTicker, model.TypeSnapshot, model.TypeL2Update:
+		// messages of other subscribed channels, not aggregated
+	default:
+		log.Printf("unknown message: type=%q", messageType)
+	}
+}
 
-			// add data point to VWAP util based on Trading Pair in message (Product ID)
-			aggregator.Utils[dataPoint.ProductID].Add(price, size)
-			// output all Trading Pairs data using aggregator
-			aggregator.ToOutput()
+// monitorStaleness - checks for stale trading pairs every staleCheckInterval, until done is closed
+func monitorStaleness(aggregator *utils.Aggregator, done <-chan struct{}) {
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			aggregator.CheckStale()
 		}
 	}
 }
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"CoinbaseMatchesVWAP/metrics"
 	"CoinbaseMatchesVWAP/model"
 	"CoinbaseMatchesVWAP/utils"
+	"CoinbaseMatchesVWAP/websocketClient"
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
 	"testing"
 	"time"
 )
@@ -41,21 +47,166 @@ func TestValidateConfig_Invalid(t *testing.T) {
 	}
 }
 
+// TestValidateConfig_TimeWindow - validates per pair time window settings
+func TestValidateConfig_TimeWindow(t *testing.T) {
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-BTC"},
+		SocketAddress: "test",
+		Window:        200,
+		Pairs: map[string]model.PairConfig{
+			"ETH-BTC": {WindowType: model.WindowTypeTime},
+		},
+	}
+	// ETH-BTC has a time window without duration
+	err := validateConfig(config)
+	if err == nil {
+		t.Error(`expected "No WINDOW_DURATION in configuration for ETH-BTC" error, got nil`)
+	}
+
+	config.Pairs["ETH-BTC"] = model.PairConfig{
+		WindowType:     model.WindowTypeTime,
+		WindowDuration: model.Duration(5 * time.Minute),
+	}
+	err = validateConfig(config)
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+// TestValidateConfig_CalculationMode - validates per pair calculation mode
+func TestValidateConfig_CalculationMode(t *testing.T) {
+	config := model.Config{
+		TradePairs:      []string{"BTC-USD", "ETH-BTC"},
+		SocketAddress:   "test",
+		Window:          200,
+		CalculationMode: model.CalculationModeStandard,
+		Pairs: map[string]model.PairConfig{
+			"ETH-BTC": {CalculationMode: "median"},
+		},
+	}
+	err := validateConfig(config)
+	if err == nil {
+		t.Error(`expected "Invalid CALCULATION_MODE" error, got nil`)
+	}
+
+	config.Pairs["ETH-BTC"] = model.PairConfig{CalculationMode: model.CalculationModeTypical}
+	err = validateConfig(config)
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+// TestKeepalivePolicy - tests that configured keepalive durations override defaults, and negative ones disable their check
+func TestKeepalivePolicy(t *testing.T) {
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD"},
+		SocketAddress: "test",
+		Window:        200,
+		PongTimeout:   model.Duration(5 * time.Second),
+	}
+	expected := websocketClient.DefaultKeepalivePolicy
+	expected.PongTimeout = 5 * time.Second
+	result := keepalivePolicy(config)
+	if result != expected {
+		t.Errorf("expected %+v got %+v", expected, result)
+	}
+
+	config.PingInterval = model.Duration(-1)
+	config.ReadTimeout = model.Duration(-time.Second)
+	expected.PingInterval = 0
+	expected.ReadTimeout = 0
+	result = keepalivePolicy(config)
+	if result != expected {
+		t.Errorf("expected %+v got %+v", expected, result)
+	}
+	if err := validateConfig(config); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+// TestSocketOptions - tests that SOCKET_ADDRESS is either a host or a full URL
+func TestSocketOptions(t *testing.T) {
+	result := socketOptions("ws-feed.exchange.coinbase.com")
+	if result.Address != "ws-feed.exchange.coinbase.com" || result.URL != "" {
+		t.Errorf("expected address %s got %+v", "ws-feed.exchange.coinbase.com", result)
+	}
+	result = socketOptions("ws://localhost:8080/ws")
+	if result.URL != "ws://localhost:8080/ws" || result.Address != "" {
+		t.Errorf("expected URL %s got %+v", "ws://localhost:8080/ws", result)
+	}
+}
+
+// TestReconnectPolicy - tests that reconnect attempts and failures are counted
+func TestReconnectPolicy(t *testing.T) {
+	attempts, failures := metrics.ReconnectAttempts.Value(), metrics.ReconnectFailures.Value()
+	policy := reconnectPolicy()
+	if policy.MaxAttempts != websocketClient.DefaultReconnectPolicy.MaxAttempts {
+		t.Errorf("expected %d attempts got %d", websocketClient.DefaultReconnectPolicy.MaxAttempts, policy.MaxAttempts)
+	}
+
+	policy.OnReconnect(websocketClient.ReconnectEvent{Attempt: 1, Err: errors.New("refused")})
+	policy.OnReconnect(websocketClient.ReconnectEvent{Attempt: 2})
+	if result := metrics.ReconnectAttempts.Value() - attempts; result != 2 {
+		t.Errorf("expected %d attempts got %d", 2, result)
+	}
+	if result := metrics.ReconnectFailures.Value() - failures; result != 1 {
+		t.Errorf("expected %d failures got %d", 1, result)
+	}
+}
+
+// TestParseFlags - tests that -addr is defined before flags are parsed, and is empty when not set
+func TestParseFlags(t *testing.T) {
+	newFlagSet := func() *flag.FlagSet {
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		flagSet.SetOutput(ioutil.Discard)
+		return flagSet
+	}
+
+	result, err := parseFlags(newFlagSet(), []string{"-addr", "localhost:1"})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if result.addr != "localhost:1" {
+		t.Errorf("expected addr %s got %s", "localhost:1", result.addr)
+	}
+
+	result, err = parseFlags(newFlagSet(), nil)
+	if err != nil || result.addr != "" {
+		t.Errorf("expected empty addr without error got %q, %v", result.addr, err)
+	}
+
+	_, err = parseFlags(newFlagSet(), []string{"-unknown"})
+	if err == nil {
+		t.Error("expected error for undefined flag got nil")
+	}
+}
+
 // TestStartRead - tests startRead function
 func TestStartRead(t *testing.T) {
-	expected := `Trading Pair for the latest 1 trades: BTC-USD, VWAP: 64632.950000
-Trading Pair for the latest 0 trades: ETH-USD, VWAP: NaN
-Trading Pair for the latest 0 trades: ETH-BTC, VWAP: NaN`
+	expected := `Trading Pair for the latest 200 trades (1 trades): BTC-USD, VWAP: 64632.950000
+Trading Pair for the latest 200 trades (0 trades): ETH-USD, VWAP: NaN
+Trading Pair for the latest 200 trades (0 trades): ETH-BTC, VWAP: NaN`
 	read := make(chan []byte)
 	aggregator := utils.NewAggregator(config)
-	done := make(chan struct{})
-	go startRead(read, aggregator, done)
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{}, 0, ""))
+	}()
 
 	testMsg := `{"type":"match","trade_id":234704065,"maker_order_id":"8c5d05a4-41c8-41f8-abc0-a49f09072bfd","taker_order_id":"d9827159-d335-4a68-931d-5a66ee0f1de3","side":"sell","size":"0.00002416","price":"64632.95","product_id":"BTC-USD","sequence":30995303205,"time":"2021-11-11T08:35:56.588997Z"}`
 	// send message to read channel. Message should be processed in startRead for loop
 	read <- []byte(testMsg)
 
-	time.Sleep(time.Second * 2)
+	// startRead returns once read channel is closed, after processing all messages
+	close(read)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("startRead did not stop after read channel was closed")
+	}
 
 	// check if message was read and successfully processed by aggregator
 	if aggregator.ToString() != expected {
@@ -64,35 +215,208 @@ Trading Pair for the latest 0 trades: ETH-BTC, VWAP: NaN`
 }
 
 // TestStartRead_InvalidDataPoint - tests startRead function
-// Invalid data point message is sent to read channel
+// Invalid data points are skipped as dead letters, and reading continues
 func TestStartRead_InvalidDataPoint(t *testing.T) {
-	expected := `Trading Pair for the latest 0 trades: BTC-USD, VWAP: NaN
-Trading Pair for the latest 0 trades: ETH-USD, VWAP: NaN
-Trading Pair for the latest 0 trades: ETH-BTC, VWAP: NaN`
+	expected := `Trading Pair for the latest 200 trades (1 trades): BTC-USD, VWAP: 64632.950000
+Trading Pair for the latest 200 trades (0 trades): ETH-USD, VWAP: NaN
+Trading Pair for the latest 200 trades (0 trades): ETH-BTC, VWAP: NaN`
 	read := make(chan []byte)
 	aggregator := utils.NewAggregator(config)
-	done := make(chan struct{})
-	go startRead(read, aggregator, done)
+	dead := &deadLetters{}
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, dead, 0, ""))
+	}()
 
-	testMsg := `invalid message`
-	// send message to read channel. Message should be processed in startRead for loop
-	read <- []byte(testMsg)
+	// send invalid message and a match with an invalid price, followed by a valid match
+	read <- []byte(`invalid message`)
+	read <- []byte(`{"type":"match","trade_id":234704064,"size":"0.00002416","price":"not a price","product_id":"BTC-USD","sequence":30995303204}`)
+	read <- []byte(`{"type":"match","trade_id":234704065,"size":"0.00002416","price":"64632.95","product_id":"BTC-USD","sequence":30995303205,"time":"2021-11-11T08:35:56.588997Z"}`)
+	close(read)
 
-	time.Sleep(time.Second * 5)
-
-	for {
-		select {
-		// check if done message was receive
-		case <-done:
-			// aggregator should have no data (Nan VWAP should be present for all trading pairs)
-			if aggregator.ToString() != expected {
-				t.Errorf("expected %s got %s", expected, aggregator.ToString())
-			}
-			return
-		case <-time.After(2 * time.Second):
-			// check if 2 seconds passed without receiving a done message
-			t.Errorf("no done message received")
-			return
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected no error, got: %v", err)
 		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("startRead did not stop after read channel was closed")
+	}
+
+	if dead.Count() != 2 {
+		t.Errorf("expected %d dead letters got %d", 2, dead.Count())
+	}
+	// valid match is aggregated
+	if aggregator.ToString() != expected {
+		t.Errorf("expected %s got %s", expected, aggregator.ToString())
+	}
+}
+
+// TestStartRead_DeadLetterThreshold - tests that startRead stops once there are more dead letters than threshold
+func TestStartRead_DeadLetterThreshold(t *testing.T) {
+	read := make(chan []byte)
+	aggregator := utils.NewAggregator(config)
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{threshold: 2}, 0, ""))
+	}()
+
+	for i := 0; i < 3; i++ {
+		read <- []byte(`invalid message`)
+	}
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("expected feed considered broken error, got nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("startRead did not stop")
+	}
+}
+
+// TestStartRead_UnknownProduct - tests that matches of unknown products rejected by aggregator are dead letters
+func TestStartRead_UnknownProduct(t *testing.T) {
+	config := model.Config{
+		TradePairs:           []string{"BTC-USD"},
+		Window:               200,
+		UnknownProductPolicy: utils.UnknownProductError,
+	}
+	read := make(chan []byte)
+	aggregator := utils.NewAggregator(config)
+	dead := &deadLetters{}
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, dead, 0, ""))
+	}()
+
+	read <- []byte(`{"type":"match","trade_id":1,"size":"1","price":"2","product_id":"ETH-USD","sequence":1}`)
+	close(read)
+	if err := <-result; err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	if dead.Count() != 1 {
+		t.Errorf("expected %d dead letters got %d", 1, dead.Count())
+	}
+}
+
+// TestStartRead_Replay - replays a recorded session through startRead and compares VWAP output
+func TestStartRead_Replay(t *testing.T) {
+	expected := `Trading Pair for the latest 200 trades (3 trades): BTC-USD, VWAP: 64631.066667
+Trading Pair for the latest 200 trades (2 trades): ETH-USD, VWAP: 4716.373333
+Trading Pair for the latest 200 trades (1 trades): ETH-BTC, VWAP: 0.072960`
+	read := make(chan []byte)
+	aggregator := utils.NewAggregator(config)
+	parsed := metrics.MessagesParsed.Value()
+	ignored := metrics.MessagesIgnored.Value()
+	replayDone := make(chan struct{})
+
+	client, err := websocketClient.NewReplayClient("testdata/session.jsonl", 0, replayDone)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	client.Read(read)
+
+	// replay client closes read channel once finished, so startRead returns after processing last frame
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{}, 0, ""))
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("replay did not finish")
+	}
+
+	if aggregator.ToString() != expected {
+		t.Errorf("expected %s got %s", expected, aggregator.ToString())
+	}
+
+	// session holds a subscriptions message and 6 matches
+	if metrics.MessagesParsed.Value()-parsed != 6 {
+		t.Errorf("expected %d parsed messages got %d", 6, metrics.MessagesParsed.Value()-parsed)
+	}
+	if metrics.MessagesIgnored.Value()-ignored != 1 {
+		t.Errorf("expected %d ignored messages got %d", 1, metrics.MessagesIgnored.Value()-ignored)
+	}
+}
+
+// TestValidateConfig_AllErrors - tests that all problems are reported at once, naming the trading pair
+func TestValidateConfig_AllErrors(t *testing.T) {
+	precision := -1
+	above, below := 100.0, 200.0
+	config := model.Config{
+		TradePairs:     []string{"BTC-USD", "ETH-BTC"},
+		Window:         200,
+		SequencePolicy: "unknown",
+		Pairs: map[string]model.PairConfig{
+			"ETH-BTC": {Precision: &precision, AlertAbove: &above, AlertBelow: &below},
+		},
+	}
+	expected := `No SOCKET_ADDRESS in configuration
+Invalid SEQUENCE_POLICY "unknown" in configuration
+PRECISION in configuration for ETH-BTC must not be negative
+ALERT_BELOW in configuration for ETH-BTC must be lower than ALERT_ABOVE`
+
+	err := validateConfig(config)
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %s got %v", expected, err)
+	}
+}
+
+// TestValidateConfig_PairsOnly - validates a config defining trading pairs only in PAIRS
+func TestValidateConfig_PairsOnly(t *testing.T) {
+	disabled := false
+	config := model.Config{
+		SocketAddress: "test",
+		Window:        200,
+		Pairs: map[string]model.PairConfig{
+			"BTC-USD": {},
+			"ETH-BTC": {Enabled: &disabled, WindowType: "unknown"},
+		},
+	}
+	// disabled trading pairs are not validated
+	err := validateConfig(config)
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	config.Pairs["BTC-USD"] = model.PairConfig{Enabled: &disabled}
+	err = validateConfig(config)
+	if err == nil {
+		t.Error(`expected "No TRADE_PAIRS in configuration" error, got nil`)
+	}
+}
+
+// TestHandleMessage - tests handling of subscriptions and error messages
+func TestHandleMessage(t *testing.T) {
+	expected := `Trading Pair for the latest 200 trades (0 trades): BTC-USD, VWAP: NaN
+Trading Pair for the latest 200 trades (0 trades): ZZZ-USD, VWAP: NaN (REJECTED: Failed to subscribe: ZZZ-USD is not a valid product)`
+	aggregator := utils.NewAggregator(model.Config{
+		TradePairs:    []string{"BTC-USD", "ZZZ-USD"},
+		SocketAddress: "test",
+		Window:        200,
+	})
+	errorMessages := metrics.ErrorMessages.Value()
+
+	handleMessage(model.TypeSubscriptions, []byte(`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`), aggregator)
+	handleMessage(model.TypeError, []byte(`{"type":"error","message":"Failed to subscribe","reason":"ZZZ-USD is not a valid product"}`), aggregator)
+	handleMessage("unknown", []byte(`{"type":"unknown"}`), aggregator)
+
+	btc, _ := aggregator.Status.Get("BTC-USD")
+	if btc.Status != utils.StatusSubscribed {
+		t.Errorf("expected status %s got %s", utils.StatusSubscribed, btc.Status)
+	}
+	if aggregator.ToString() != expected {
+		t.Errorf("expected %s got %s", expected, aggregator.ToString())
+	}
+	if metrics.ErrorMessages.Value()-errorMessages != 1 {
+		t.Errorf("expected %d error messages got %d", 1, metrics.ErrorMessages.Value()-errorMessages)
+	}
+	if _, err := aggregator.Status.WaitSubscribed(context.Background(), time.Second); err == nil {
+		t.Error("expected error naming ZZZ-USD, got nil")
 	}
 }
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"CoinbaseMatchesVWAP/utils"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Ingestion metrics, updated while reading messages from websocket
+var (
+	MessagesReceived  = NewCounter("coinbase_messages_received_total", "Messages received from websocket.")
+	MessagesParsed    = NewCounter("coinbase_messages_parsed_total", "Match messages parsed and added to aggregator.")
+	MessagesIgnored   = NewCounter("coinbase_messages_ignored_total", "Messages ignored because they are not matches.")
+	ParseFailures     = NewCounter("coinbase_parse_failures_total", "Messages which failed to parse.")
+	ErrorMessages     = NewCounter("coinbase_error_messages_total", "Error messages received from websocket.")
+	QueueOverflows    = NewCounter("coinbase_queue_overflows_total", "Matches dropped because the queue of their trading pair was full.")
+	ReconnectAttempts = NewCounter("coinbase_reconnect_attempts_total", "Attempts to reconnect to websocket.")
+	ReconnectFailures = NewCounter("coinbase_reconnect_failures_total", "Attempts to reconnect to websocket which failed.")
+	ProcessingLatency = NewHistogram("coinbase_processing_latency_seconds", "Latency from match time to aggregation.",
+		[]float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+)
+
+// ingestion - all ingestion metrics, in exposition order
+var ingestion = []collector{MessagesReceived, MessagesParsed, MessagesIgnored, ParseFailures, ErrorMessages, QueueOverflows,
+	ReconnectAttempts, ReconnectFailures, ProcessingLatency}
+
+// collector - a metric which can be written in Prometheus text exposition format
+type collector interface {
+	write(w io.Writer)
+}
+
+// Counter - monotonically increasing metric
+type Counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+// NewCounter - initializes a new counter
+func NewCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+// Inc - increments counter by 1
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Value - returns current value of counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// write - writes counter in text exposition format
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Histogram - counts observations in cumulative buckets
+type Histogram struct {
+	mu   sync.Mutex
+	name string
+	help string
+	// bounds - upper bounds of buckets, sorted ascending
+	bounds []float64
+	// counts - observations per bucket, last bucket is +Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram - initializes a new histogram with bucket upper bounds
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		name:   name,
+		help:   help,
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe - records an observation
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[sort.SearchFloat64s(h.bounds, value)]++
+	h.sum += value
+	h.count++
+}
+
+// Count - returns number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// write - writes histogram in text exposition format
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// pairGauge - gauge with a value per slide window of each trading pair, read from snapshots at scrape time
+type pairGauge struct {
+	name  string
+	help  string
+	value func(snapshot utils.VWAPSnapshot) float64
+}
+
+// pairGauges - per trading pair gauges, in exposition order
+var pairGauges = []pairGauge{
+	{"coinbase_vwap", "Current VWAP of trading pair, NaN while window is empty.", func(s utils.VWAPSnapshot) float64 { return s.VWAP }},
+	{"coinbase_window_trades", "Number of trades in sliding window.", func(s utils.VWAPSnapshot) float64 { return float64(s.Trades) }},
+	{"coinbase_cumulated_volume", "Total volume of trades in sliding window.", func(s utils.VWAPSnapshot) float64 { return s.CumulatedVolume }},
+	{"coinbase_min_price", "Minimum price in sliding window.", func(s utils.VWAPSnapshot) float64 { return s.MinPrice }},
+	{"coinbase_max_price", "Maximum price in sliding window.", func(s utils.VWAPSnapshot) float64 { return s.MaxPrice }},
+}
+
+// pairCounters - per trading pair counters, in exposition order
+var pairCounters = []pairGauge{
+	{"coinbase_sequence_gaps_total", "Gaps in trade ids of trading pair, i.e. matches which were not received.", func(s utils.VWAPSnapshot) float64 { return float64(s.Sequence.Gaps) }},
+	{"coinbase_sequence_duplicates_total", "Duplicate matches of trading pair.", func(s utils.VWAPSnapshot) float64 { return float64(s.Sequence.Duplicates) }},
+	{"coinbase_sequence_out_of_order_total", "Matches of trading pair received out of order.", func(s utils.VWAPSnapshot) float64 { return float64(s.Sequence.OutOfOrder) }},
+}
+
+// Write - writes ingestion metrics and per trading pair gauges in Prometheus text exposition format
+func Write(w io.Writer, snapshots []utils.VWAPSnapshot) {
+	for _, c := range ingestion {
+		c.write(w)
+	}
+
+	for _, gauge := range pairGauges {
+		writeHeader(w, gauge.name, gauge.help, "gauge")
+		for _, snapshot := range snapshots {
+			// a sample per slide window of trading pair
+			for _, window := range snapshot.AllWindows() {
+				fmt.Fprintf(w, "%s{pair=\"%s\",window=\"%s\"} %s\n", gauge.name, escapeLabel(window.Pair), escapeLabel(window.WindowLabel()), formatFloat(gauge.value(window)))
+			}
+		}
+	}
+
+	for _, counter := range pairCounters {
+		writeHeader(w, counter.name, counter.help, "counter")
+		for _, snapshot := range snapshots {
+			fmt.Fprintf(w, "%s{pair=\"%s\"} %s\n", counter.name, escapeLabel(snapshot.Pair), formatFloat(counter.value(snapshot)))
+		}
+	}
+}
+
+// Handler - serves metrics, reading trading pair state from snapshot on each scrape
+func Handler(snapshot func() []utils.VWAPSnapshot) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buffered := bufio.NewWriter(w)
+		Write(buffered, snapshot())
+		buffered.Flush()
+	})
+}
+
+// writeHeader - writes HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// formatFloat - formats a sample value, including NaN and infinities
+func formatFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeLabel - escapes a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"CoinbaseMatchesVWAP/utils"
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCounter - tests Counter in text exposition format
+func TestCounter(t *testing.T) {
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total 2
+`
+	counter := NewCounter("test_total", "Test counter.")
+	counter.Inc()
+	counter.Inc()
+
+	var buffer bytes.Buffer
+	counter.write(&buffer)
+
+	if buffer.String() != expected {
+		t.Errorf("expected \n%s got \n%s", expected, buffer.String())
+	}
+}
+
+// TestHistogram - tests Histogram in text exposition format, buckets are cumulative
+func TestHistogram(t *testing.T) {
+	expected := `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 6.05
+test_seconds_count 4
+`
+	histogram := NewHistogram("test_seconds", "Test histogram.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var buffer bytes.Buffer
+	histogram.write(&buffer)
+
+	if buffer.String() != expected {
+		t.Errorf("expected \n%s got \n%s", expected, buffer.String())
+	}
+}
+
+// TestHandler - tests that per trading pair gauges are served
+func TestHandler(t *testing.T) {
+	snapshots := []utils.VWAPSnapshot{
+		{Pair: "BTC-USD", VWAP: 64632.95, WindowType: model.WindowTypeTrades, Window: 200, Trades: 3, CumulatedVolume: 0.5, MinPrice: 64630.1, MaxPrice: 64633},
+		{Pair: "ETH-USD", VWAP: math.NaN(), WindowType: model.WindowTypeTrades, Window: 200},
+	}
+	recorder := httptest.NewRecorder()
+
+	Handler(func() []utils.VWAPSnapshot { return snapshots }).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE coinbase_messages_received_total counter",
+		"# TYPE coinbase_processing_latency_seconds histogram",
+		"# TYPE coinbase_vwap gauge",
+		`coinbase_vwap{pair="BTC-USD",window="200"} 64632.95`,
+		`coinbase_vwap{pair="ETH-USD",window="200"} NaN`,
+		`coinbase_window_trades{pair="BTC-USD",window="200"} 3`,
+		`coinbase_cumulated_volume{pair="BTC-USD",window="200"} 0.5`,
+		`coinbase_min_price{pair="BTC-USD",window="200"} 64630.1`,
+		`coinbase_max_price{pair="BTC-USD",window="200"} 64633`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %s in \n%s", line, body)
+		}
+	}
+}
+
+// TestHandler_Windows - tests that a sample is served for each slide window of a trading pair
+func TestHandler_Windows(t *testing.T) {
+	trades := utils.VWAPSnapshot{Pair: "BTC-USD", VWAP: 1, WindowType: model.WindowTypeTrades, Window: 50}
+	minute := utils.VWAPSnapshot{Pair: "BTC-USD", VWAP: 2, WindowType: model.WindowTypeTime, WindowDuration: time.Minute}
+	pair := trades
+	pair.Windows = []utils.VWAPSnapshot{trades, minute}
+	recorder := httptest.NewRecorder()
+
+	Handler(func() []utils.VWAPSnapshot { return []utils.VWAPSnapshot{pair} }).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`coinbase_vwap{pair="BTC-USD",window="50"} 1`,
+		`coinbase_vwap{pair="BTC-USD",window="1m0s"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %s in \n%s", line, body)
+		}
+	}
+}
+
+// TestHandler_Sequence - tests that sequence anomaly counters are served once per trading pair
+func TestHandler_Sequence(t *testing.T) {
+	trades := utils.VWAPSnapshot{Pair: "BTC-USD", VWAP: 1, WindowType: model.WindowTypeTrades, Window: 50}
+	minute := utils.VWAPSnapshot{Pair: "BTC-USD", VWAP: 2, WindowType: model.WindowTypeTime, WindowDuration: time.Minute}
+	pair := trades
+	pair.Windows = []utils.VWAPSnapshot{trades, minute}
+	pair.Sequence = utils.SequenceStats{Gaps: 3, Duplicates: 2, OutOfOrder: 1}
+	recorder := httptest.NewRecorder()
+
+	Handler(func() []utils.VWAPSnapshot { return []utils.VWAPSnapshot{pair} }).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE coinbase_sequence_gaps_total counter",
+		`coinbase_sequence_gaps_total{pair="BTC-USD"} 3`,
+		`coinbase_sequence_duplicates_total{pair="BTC-USD"} 2`,
+		`coinbase_sequence_out_of_order_total{pair="BTC-USD"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %s in \n%s", line, body)
+		}
+	}
+	if count := strings.Count(body, "coinbase_sequence_gaps_total{"); count != 1 {
+		t.Errorf("expected %d samples got %d", 1, count)
+	}
+}
@@ -1,9 +1,268 @@
 package model
 
+import (
+	"sort"
+	"time"
+)
+
+// DefaultDecimalScale - digits after decimal point of VWAP in decimal mode, when not configured
+const DefaultDecimalScale = 8
+
+// DefaultHeartbeatTimeout - time without heartbeats after which a trading pair is stale, when not configured
+const DefaultHeartbeatTimeout = 5 * time.Second
+
+// DefaultQueueSize - capacity of queue of matches of each trading pair, when not configured
+const DefaultQueueSize = 1024
+
+// DefaultPrecision - digits after decimal point of VWAP output, when not configured
+const DefaultPrecision = 6
+
+const (
+	// WindowTypeTrades - slide window limited to the last N trades
+	WindowTypeTrades = "trades"
+	// WindowTypeTime - slide window limited to trades within the last N units of time
+	WindowTypeTime = "time"
+)
+
+const (
+	// CalculationModeTypical - VWAP is the typical price (max + min + last) / 3 of the slide window
+	CalculationModeTypical = "typical"
+	// CalculationModeStandard - VWAP is sum(price * volume) / sum(volume) over the slide window
+	CalculationModeStandard = "standard"
+)
+
 // Config models configuration file for app
 type Config struct {
-	TradePairs    []string `json:"TRADE_PAIRS"`
-	SocketAddress string   `json:"SOCKET_ADDRESS"`
-	ClearConsole  bool     `json:"CLEAR_CONSOLE"`
-	Window        int     `json:"WINDOW"`
+	TradePairs     []string              `json:"TRADE_PAIRS"`
+	SocketAddress  string                `json:"SOCKET_ADDRESS"`
+	ClearConsole   bool                  `json:"CLEAR_CONSOLE"`
+	Window         int                   `json:"WINDOW"`
+	WindowType     string                `json:"WINDOW_TYPE"`
+	WindowDuration Duration              `json:"WINDOW_DURATION"`
+	Pairs          map[string]PairConfig `json:"PAIRS"`
+	// Windows - slide windows calculated for all trading pairs, replaces WINDOW_TYPE, WINDOW and WINDOW_DURATION when set
+	Windows []WindowConfig `json:"WINDOWS"`
+	// CalculationMode - default VWAP formula for all trading pairs ("typical" or "standard")
+	CalculationMode string `json:"CALCULATION_MODE"`
+	// Precision - default digits after decimal point of VWAP output for all trading pairs
+	Precision *int `json:"PRECISION"`
+	// Channels - channels subscribed for all trading pairs in addition to matches, e.g. "ticker" or "heartbeat"
+	Channels       []string `json:"CHANNELS"`
+	SequencePolicy string   `json:"SEQUENCE_POLICY"`
+	// UnknownProductPolicy - handling of matches of products which are not configured ("drop", "create" or "error")
+	UnknownProductPolicy string `json:"UNKNOWN_PRODUCT_POLICY"`
+	// HeartbeatTimeout - time without heartbeats after which a trading pair is stale, when subscribed to heartbeat channel
+	HeartbeatTimeout Duration `json:"HEARTBEAT_TIMEOUT"`
+	// StaleAfter - time without any message after which a trading pair is stale, 0 (default) does not check
+	StaleAfter  Duration `json:"STALE_AFTER"`
+	StalePolicy string   `json:"STALE_POLICY"`
+	// PingInterval, PongTimeout, ReadTimeout and WriteTimeout - keepalive of websocket connection, defaults apply when not set,
+	// a negative duration disables the check
+	PingInterval Duration `json:"PING_INTERVAL"`
+	PongTimeout  Duration `json:"PONG_TIMEOUT"`
+	ReadTimeout  Duration `json:"READ_TIMEOUT"`
+	WriteTimeout Duration `json:"WRITE_TIMEOUT"`
+	// QueueSize and OverflowPolicy - capacity of queue of matches of each trading pair, and handling of matches arriving at a full queue
+	QueueSize      int    `json:"QUEUE_SIZE"`
+	OverflowPolicy string `json:"OVERFLOW_POLICY"`
+	// OutputMode - cadence of output ("every", "interval" or "threshold"), with OutputInterval and OutputThreshold of the latter two
+	OutputMode      string   `json:"OUTPUT_MODE"`
+	OutputInterval  Duration `json:"OUTPUT_INTERVAL"`
+	OutputThreshold float64  `json:"OUTPUT_THRESHOLD"`
+	// QuarantineFile - JSONL file messages which can't be parsed are appended to
+	QuarantineFile string `json:"QUARANTINE_FILE"`
+	// DeadLetterThreshold - number of messages which can't be parsed after which the feed is considered broken, 0 for no limit
+	DeadLetterThreshold int     `json:"DEAD_LETTER_THRESHOLD"`
+	RecordFile          string  `json:"RECORD_FILE"`
+	ReplayFile          string  `json:"REPLAY_FILE"`
+	ReplaySpeed         float64 `json:"REPLAY_SPEED"`
+	HTTPAddress         string  `json:"HTTP_ADDRESS"`
+	StreamPolicy        string  `json:"STREAM_POLICY"`
+	StreamBuffer        int     `json:"STREAM_BUFFER"`
+	// DecimalMode - parse and accumulate prices and sizes as exact decimals instead of floats
+	DecimalMode bool `json:"DECIMAL_MODE"`
+	// DecimalScale - digits after decimal point of VWAP in decimal mode, a pointer so 0 can be configured
+	DecimalScale    *int   `json:"DECIMAL_SCALE"`
+	DecimalRounding string `json:"DECIMAL_ROUNDING"`
+}
+
+// GetDecimalScale - returns digits after decimal point of VWAP in decimal mode
+func (c Config) GetDecimalScale() int {
+	if c.DecimalScale == nil {
+		return DefaultDecimalScale
+	}
+	return *c.DecimalScale
+}
+
+// GetTradePairs - returns all enabled trading pairs: TRADE_PAIRS in configured order,
+// followed by trading pairs only defined in PAIRS, sorted by name
+func (c Config) GetTradePairs() []string {
+	var pairs []string
+	seen := map[string]bool{}
+	for _, pair := range c.TradePairs {
+		if !seen[pair] && c.ForPair(pair).IsEnabled() {
+			pairs = append(pairs, pair)
+		}
+		seen[pair] = true
+	}
+
+	var extra []string
+	for pair := range c.Pairs {
+		if !seen[pair] && c.ForPair(pair).IsEnabled() {
+			extra = append(extra, pair)
+		}
+	}
+	sort.Strings(extra)
+
+	return append(pairs, extra...)
+}
+
+// HasChannel - reports whether a channel is subscribed for all trading pairs
+func (c Config) HasChannel(name string) bool {
+	for _, channel := range c.GetChannels() {
+		if channel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHeartbeatTimeout - returns time without heartbeats after which a trading pair is stale, 0 if heartbeat channel is not subscribed
+func (c Config) GetHeartbeatTimeout() time.Duration {
+	if !c.HasChannel(ChannelHeartbeat) {
+		return 0
+	}
+	if c.HeartbeatTimeout == 0 {
+		return DefaultHeartbeatTimeout
+	}
+	return time.Duration(c.HeartbeatTimeout)
+}
+
+// GetChannels - returns channels subscribed for all enabled trading pairs, matches first
+func (c Config) GetChannels() []Channel {
+	pairs := c.GetTradePairs()
+	channels := []Channel{{Name: ChannelMatches, ProductIDs: pairs}}
+	for _, name := range c.Channels {
+		if name != ChannelMatches {
+			channels = append(channels, Channel{Name: name, ProductIDs: pairs})
+		}
+	}
+	return channels
+}
+
+// PairConfig models settings of a single trading pair.
+// Empty fields fall back to the global settings in Config.
+type PairConfig struct {
+	WindowType      string         `json:"WINDOW_TYPE"`
+	Window          int            `json:"WINDOW"`
+	WindowDuration  Duration       `json:"WINDOW_DURATION"`
+	Windows         []WindowConfig `json:"WINDOWS"`
+	CalculationMode string         `json:"CALCULATION_MODE"`
+	// Precision - digits after decimal point of VWAP output, also scale of VWAP in decimal mode
+	Precision *int `json:"PRECISION"`
+	// Enabled - trading pair is subscribed and aggregated, unless set to false
+	Enabled *bool `json:"ENABLED"`
+	// AlertAbove and AlertBelow - VWAP thresholds reported when crossed
+	AlertAbove *float64 `json:"ALERT_ABOVE"`
+	AlertBelow *float64 `json:"ALERT_BELOW"`
+}
+
+// IsEnabled - reports whether trading pair is subscribed and aggregated
+func (p PairConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// GetPrecision - returns digits after decimal point of VWAP output
+func (p PairConfig) GetPrecision() int {
+	if p.Precision == nil {
+		return DefaultPrecision
+	}
+	return *p.Precision
+}
+
+// WindowConfig models a single slide window.
+// WINDOW_TYPE may be omitted, a window with only WINDOW_DURATION is time based.
+type WindowConfig struct {
+	WindowType     string   `json:"WINDOW_TYPE"`
+	Window         int      `json:"WINDOW"`
+	WindowDuration Duration `json:"WINDOW_DURATION"`
+}
+
+// ForPair - returns the effective settings of a trading pair.
+// Windows always holds at least one window, the first one is also set as WindowType, Window and WindowDuration.
+func (c Config) ForPair(pair string) PairConfig {
+	result := PairConfig{
+		WindowType:      c.WindowType,
+		Window:          c.Window,
+		WindowDuration:  c.WindowDuration,
+		Windows:         c.Windows,
+		CalculationMode: c.CalculationMode,
+		Precision:       c.Precision,
+	}
+
+	override, ok := c.Pairs[pair]
+	if ok {
+		if override.WindowType != "" {
+			result.WindowType = override.WindowType
+		}
+		if override.Window != 0 {
+			result.Window = override.Window
+		}
+		if override.WindowDuration != 0 {
+			result.WindowDuration = override.WindowDuration
+		}
+		if len(override.Windows) > 0 {
+			result.Windows = override.Windows
+		} else if override.WindowType != "" || override.Window != 0 || override.WindowDuration != 0 {
+			// a single window override replaces global windows
+			result.Windows = nil
+		}
+		if override.CalculationMode != "" {
+			result.CalculationMode = override.CalculationMode
+		}
+		if override.Precision != nil {
+			result.Precision = override.Precision
+		}
+		result.Enabled = override.Enabled
+		result.AlertAbove = override.AlertAbove
+		result.AlertBelow = override.AlertBelow
+	}
+
+	// trade count window and typical price are the defaults
+	if result.WindowType == "" {
+		result.WindowType = WindowTypeTrades
+	}
+	if result.CalculationMode == "" {
+		result.CalculationMode = CalculationModeTypical
+	}
+
+	if len(result.Windows) == 0 {
+		result.Windows = []WindowConfig{{
+			WindowType:     result.WindowType,
+			Window:         result.Window,
+			WindowDuration: result.WindowDuration,
+		}}
+	} else {
+		windows := make([]WindowConfig, len(result.Windows))
+		for i, window := range result.Windows {
+			windows[i] = window.withDefaults()
+		}
+		result.Windows = windows
+		result.WindowType = windows[0].WindowType
+		result.Window = windows[0].Window
+		result.WindowDuration = windows[0].WindowDuration
+	}
+
+	return result
+}
+
+// withDefaults - returns window with its type set, time based if only WINDOW_DURATION is set
+func (w WindowConfig) withDefaults() WindowConfig {
+	if w.WindowType == "" {
+		w.WindowType = WindowTypeTrades
+		if w.Window == 0 && w.WindowDuration > 0 {
+			w.WindowType = WindowTypeTime
+		}
+	}
+	return w
 }
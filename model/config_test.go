@@ -0,0 +1,124 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestConfig_ForPair_Windows - tests resolution of slide windows of trading pairs
+func TestConfig_ForPair_Windows(t *testing.T) {
+	config := Config{
+		Window: 200,
+		Windows: []WindowConfig{
+			{Window: 50},
+			{WindowDuration: Duration(time.Minute)},
+		},
+		Pairs: map[string]PairConfig{
+			"ETH-BTC": {WindowType: WindowTypeTime, WindowDuration: Duration(5 * time.Minute)},
+		},
+	}
+
+	// global windows, type inferred
+	btc := config.ForPair("BTC-USD")
+	expected := []WindowConfig{
+		{WindowType: WindowTypeTrades, Window: 50},
+		{WindowType: WindowTypeTime, WindowDuration: Duration(time.Minute)},
+	}
+	if len(btc.Windows) != 2 || btc.Windows[0] != expected[0] || btc.Windows[1] != expected[1] {
+		t.Errorf("expected %v got %v", expected, btc.Windows)
+	}
+	if btc.Window != 50 {
+		t.Errorf("expected primary window of %d got %d", 50, btc.Window)
+	}
+
+	// single window override replaces global windows
+	eth := config.ForPair("ETH-BTC")
+	if len(eth.Windows) != 1 || eth.Windows[0].WindowType != WindowTypeTime || eth.Windows[0].WindowDuration != Duration(5*time.Minute) {
+		t.Errorf("expected a single 5m time window got %v", eth.Windows)
+	}
+}
+
+// TestConfig_ForPair_SingleWindow - tests that flat WINDOW settings result in a single window
+func TestConfig_ForPair_SingleWindow(t *testing.T) {
+	config := Config{Window: 200}
+
+	result := config.ForPair("BTC-USD")
+	if len(result.Windows) != 1 || result.Windows[0].WindowType != WindowTypeTrades || result.Windows[0].Window != 200 {
+		t.Errorf("expected a single trade window of %d got %v", 200, result.Windows)
+	}
+}
+
+// TestConfig_GetTradePairs - tests that trading pairs of TRADE_PAIRS and PAIRS are merged, without disabled ones
+func TestConfig_GetTradePairs(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{
+		"TRADE_PAIRS": ["ETH-USD", "BTC-USD"],
+		"WINDOW": 200,
+		"PAIRS": {
+			"BTC-USD": {"ENABLED": false},
+			"LTC-USD": {"WINDOW": 50, "PRECISION": 2, "ALERT_ABOVE": 300},
+			"ADA-USD": {}
+		}
+	}`), &config)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	expected := "[ETH-USD ADA-USD LTC-USD]"
+	if fmt.Sprint(config.GetTradePairs()) != expected {
+		t.Errorf("expected %s got %v", expected, config.GetTradePairs())
+	}
+
+	ltc := config.ForPair("LTC-USD")
+	if ltc.Window != 50 || ltc.GetPrecision() != 2 || *ltc.AlertAbove != 300 || ltc.AlertBelow != nil {
+		t.Errorf("unexpected settings %+v", ltc)
+	}
+	if config.ForPair("ETH-USD").GetPrecision() != DefaultPrecision {
+		t.Errorf("expected default precision %d got %d", DefaultPrecision, config.ForPair("ETH-USD").GetPrecision())
+	}
+}
+
+// TestConfig_GetChannels - tests that configured channels are subscribed for all trading pairs, after matches
+func TestConfig_GetChannels(t *testing.T) {
+	config := Config{
+		TradePairs: []string{"BTC-USD", "ETH-USD"},
+		Channels:   []string{ChannelHeartbeat, ChannelMatches},
+	}
+
+	expected := "[{matches [BTC-USD ETH-USD]} {heartbeat [BTC-USD ETH-USD]}]"
+	if fmt.Sprint(config.GetChannels()) != expected {
+		t.Errorf("expected %s got %v", expected, config.GetChannels())
+	}
+}
+
+// TestConfig_GetHeartbeatTimeout - tests that heartbeat timeout only applies when heartbeat channel is subscribed
+func TestConfig_GetHeartbeatTimeout(t *testing.T) {
+	config := Config{TradePairs: []string{"BTC-USD"}}
+	if config.GetHeartbeatTimeout() != 0 {
+		t.Errorf("expected no heartbeat timeout got %s", config.GetHeartbeatTimeout())
+	}
+
+	config.Channels = []string{ChannelHeartbeat}
+	if config.GetHeartbeatTimeout() != DefaultHeartbeatTimeout {
+		t.Errorf("expected heartbeat timeout %s got %s", DefaultHeartbeatTimeout, config.GetHeartbeatTimeout())
+	}
+}
+
+// TestConfig_GetDecimalScale - tests that a decimal scale of 0 is kept, and only a missing one defaults
+func TestConfig_GetDecimalScale(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{"DECIMAL_SCALE": 0}`), &config)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if config.GetDecimalScale() != 0 {
+		t.Errorf("expected decimal scale %d got %d", 0, config.GetDecimalScale())
+	}
+
+	config = Config{}
+	if config.GetDecimalScale() != DefaultDecimalScale {
+		t.Errorf("expected decimal scale %d got %d", DefaultDecimalScale, config.GetDecimalScale())
+	}
+}
@@ -1,10 +1,53 @@
 package model
 
+import "time"
+
+const (
+	// TypeMatch - type of messages received for each trade on matches channel
+	TypeMatch = "match"
+	// TypeLastMatch - type of the first message received after subscribing to matches channel
+	TypeLastMatch = "last_match"
+	// TypeError - type of messages reporting an error, e.g. a subscription to an invalid product id
+	TypeError = "error"
+	// TypeHeartbeat - type of messages received every second on heartbeat channel
+	TypeHeartbeat = "heartbeat"
+	// TypeTicker, TypeSnapshot and TypeL2Update - types of messages received on ticker and level2 channels
+	TypeTicker   = "ticker"
+	TypeSnapshot = "snapshot"
+	TypeL2Update = "l2update"
+)
+
 // DataPoint models a single data point received from coinbase websocket matches channel
 type DataPoint struct {
-	Type      string `json:"type"`
-	Side      string `json:"side"`
-	Size      string `json:"size"`
-	Price     string `json:"price"`
-	ProductID string `json:"product_id"`
-}
\ No newline at end of file
+	Type         string    `json:"type"`
+	TradeID      int64     `json:"trade_id"`
+	Sequence     int64     `json:"sequence"`
+	MakerOrderID string    `json:"maker_order_id"`
+	TakerOrderID string    `json:"taker_order_id"`
+	Side         string    `json:"side"`
+	Size         string    `json:"size"`
+	Price        string    `json:"price"`
+	ProductID    string    `json:"product_id"`
+	Time         time.Time `json:"time"`
+}
+
+// IsMatch - reports whether data point is a trade (match or last_match message)
+func (dp DataPoint) IsMatch() bool {
+	return dp.Type == TypeMatch || dp.Type == TypeLastMatch
+}
+
+// ErrorMessage models an error message received from coinbase websocket
+type ErrorMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// Heartbeat models a message received from coinbase websocket heartbeat channel
+type Heartbeat struct {
+	Type        string    `json:"type"`
+	Sequence    int64     `json:"sequence"`
+	LastTradeID int64     `json:"last_trade_id"`
+	ProductID   string    `json:"product_id"`
+	Time        time.Time `json:"time"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestDataPoint_Unmarshal - tests that all fields of a match message are parsed
+func TestDataPoint_Unmarshal(t *testing.T) {
+	message := `{"type":"match","trade_id":234704065,"maker_order_id":"8c5d05a4-41c8-41f8-abc0-a49f09072bfd","taker_order_id":"d9827159-d335-4a68-931d-5a66ee0f1de3","side":"sell","size":"0.00002416","price":"64632.95","product_id":"BTC-USD","sequence":30995303205,"time":"2021-11-11T08:35:56.588997Z"}`
+	expected := DataPoint{
+		Type:         TypeMatch,
+		TradeID:      234704065,
+		Sequence:     30995303205,
+		MakerOrderID: "8c5d05a4-41c8-41f8-abc0-a49f09072bfd",
+		TakerOrderID: "d9827159-d335-4a68-931d-5a66ee0f1de3",
+		Side:         "sell",
+		Size:         "0.00002416",
+		Price:        "64632.95",
+		ProductID:    "BTC-USD",
+		Time:         time.Date(2021, 11, 11, 8, 35, 56, 588997000, time.UTC),
+	}
+
+	var result DataPoint
+	err := json.Unmarshal([]byte(message), &result)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("expected %+v got %+v", expected, result)
+	}
+	if !result.IsMatch() {
+		t.Error("expected data point to be a match")
+	}
+}
+
+// TestDataPoint_IsMatch - tests that only match messages are reported as matches
+func TestDataPoint_IsMatch(t *testing.T) {
+	if !(DataPoint{Type: TypeLastMatch}).IsMatch() {
+		t.Error("expected last_match to be a match")
+	}
+	if (DataPoint{Type: "subscriptions"}).IsMatch() {
+		t.Error("expected subscriptions not to be a match")
+	}
+}
@@ -0,0 +1,42 @@
+package model
+
+const (
+	// TypeSubscribe - type of messages subscribing to channels
+	TypeSubscribe = "subscribe"
+	// TypeUnsubscribe - type of messages unsubscribing from channels
+	TypeUnsubscribe = "unsubscribe"
+	// TypeSubscriptions - type of messages acknowledging subscription changes, listing all current subscriptions
+	TypeSubscriptions = "subscriptions"
+)
+
+const (
+	// ChannelMatches - channel of trades
+	ChannelMatches = "matches"
+	// ChannelTicker - channel of price updates on each trade
+	ChannelTicker = "ticker"
+	// ChannelHeartbeat - channel of heartbeat messages sent every second
+	ChannelHeartbeat = "heartbeat"
+	// ChannelLevel2 - channel of order book snapshots and updates
+	ChannelLevel2 = "level2"
+)
+
+// Channel models a channel with its trading pairs, as sent in subscription messages
+type Channel struct {
+	Name       string   `json:"name"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+// SubscriptionMessage models subscribe, unsubscribe and subscriptions messages
+type SubscriptionMessage struct {
+	Type     string    `json:"type"`
+	Channels []Channel `json:"channels"`
+}
+
+// IsKnownChannel - reports whether channel can be subscribed to
+func IsKnownChannel(name string) bool {
+	switch name {
+	case ChannelMatches, ChannelTicker, ChannelHeartbeat, ChannelLevel2:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/utils"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// outputEvery - output is printed after every trade, trades arriving while printing are coalesced into one output
+	outputEvery = "every"
+	// outputInterval - output is printed at a fixed interval, if any trade was added since last output
+	outputInterval = "interval"
+	// outputThreshold - output is printed when VWAP of a trading pair changed by more than a threshold since it was last printed
+	outputThreshold = "threshold"
+)
+
+// defaultOutputInterval - interval output is printed at with outputInterval, when not configured
+const defaultOutputInterval = time.Second
+
+// output - prints aggregated trade data on its own goroutine, so slow output never blocks processing of matches.
+// Updates arriving while output is printed are coalesced, only the latest state is printed.
+type output struct {
+	// mode - cadence of output, e.g. outputEvery
+	mode     string
+	interval time.Duration
+	// threshold - relative change of VWAP printed with outputThreshold, e.g. 0.001 for 0.1%
+	threshold float64
+	// print - prints aggregated trade data
+	print func()
+
+	mu sync.Mutex
+	// pending - an update is not printed yet
+	pending bool
+	// printed - VWAP of each trading pair when it was last printed, used by outputThreshold
+	printed map[string]float64
+	// notify - signals a pending update to be printed immediately
+	notify chan struct{}
+}
+
+// newOutput - initializes output printing with print in mode, default outputEvery
+func newOutput(mode string, interval time.Duration, threshold float64, print func()) *output {
+	if mode == "" {
+		mode = outputEvery
+	}
+	if interval <= 0 {
+		interval = defaultOutputInterval
+	}
+	return &output{
+		mode:      mode,
+		interval:  interval,
+		threshold: threshold,
+		print:     print,
+		printed:   map[string]float64{},
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// Update - records an update of a trading pair, registered as listener of aggregator. Never blocks.
+func (o *output) Update(snapshot utils.VWAPSnapshot) {
+	o.mu.Lock()
+	if o.mode == outputThreshold && !o.changed(snapshot) {
+		o.mu.Unlock()
+		return
+	}
+	o.pending = true
+	o.mu.Unlock()
+
+	// interval output is printed by ticker only
+	if o.mode == outputInterval {
+		return
+	}
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// changed - reports whether VWAP of a trading pair changed by more than threshold since it was last printed,
+// and records it as printed if so. Must be called holding mu.
+func (o *output) changed(snapshot utils.VWAPSnapshot) bool {
+	previous, ok := o.printed[snapshot.Pair]
+	// VWAP is NaN while slide window is empty
+	if ok && math.IsNaN(previous) == math.IsNaN(snapshot.VWAP) {
+		if math.IsNaN(previous) || math.Abs(snapshot.VWAP-previous) <= math.Abs(previous)*o.threshold {
+			return false
+		}
+	}
+	o.printed[snapshot.Pair] = snapshot.VWAP
+	return true
+}
+
+// take - reports whether an update is pending, and marks it as printed
+func (o *output) take() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending := o.pending
+	o.pending = false
+	return pending
+}
+
+// run - prints pending updates according to mode, until done is closed
+func (o *output) run(done <-chan struct{}) {
+	var tick <-chan time.Time
+	if o.mode == outputInterval {
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-o.notify:
+		case <-tick:
+		}
+		if o.take() {
+			o.print()
+		}
+	}
+}
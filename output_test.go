@@ -0,0 +1,96 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/utils"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestOutput_Every - tests that updates arriving while output is printed are coalesced, and slow output never blocks updates
+func TestOutput_Every(t *testing.T) {
+	var prints int32
+	release := make(chan struct{})
+	o := newOutput(outputEvery, 0, 0, func() {
+		atomic.AddInt32(&prints, 1)
+		<-release
+	})
+	done := make(chan struct{})
+	defer close(done)
+	go o.run(done)
+
+	updated := make(chan struct{})
+	go func() {
+		for i := 1; i <= 1000; i++ {
+			o.Update(utils.VWAPSnapshot{Pair: "BTC-USD", VWAP: float64(i)})
+		}
+		close(updated)
+	}()
+	select {
+	case <-updated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected updates not to be blocked by slow output")
+	}
+
+	// first output is still printing, all other updates are coalesced into one more output
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if result := atomic.LoadInt32(&prints); result < 1 || result > 2 {
+		t.Errorf("expected %d to %d outputs got %d", 1, 2, result)
+	}
+}
+
+// TestOutput_Interval - tests that output is printed at interval only if there was an update
+func TestOutput_Interval(t *testing.T) {
+	prints := make(chan struct{}, 10)
+	o := newOutput(outputInterval, 20*time.Millisecond, 0, func() {
+		prints <- struct{}{}
+	})
+	done := make(chan struct{})
+	defer close(done)
+	go o.run(done)
+
+	for i := 1; i <= 100; i++ {
+		o.Update(utils.VWAPSnapshot{Pair: "BTC-USD", VWAP: float64(i)})
+	}
+	select {
+	case <-prints:
+	case <-time.After(time.Second):
+		t.Fatal("expected output after interval")
+	}
+
+	// no update since last output
+	select {
+	case <-prints:
+		t.Error("expected no output without updates")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestOutput_changed - tests that only a VWAP change above threshold is printed, relative to VWAP last printed
+func TestOutput_changed(t *testing.T) {
+	o := newOutput(outputThreshold, 0, 0.01, func() {})
+
+	tests := []struct {
+		pair     string
+		vwap     float64
+		expected bool
+	}{
+		{"BTC-USD", math.NaN(), true},
+		{"BTC-USD", math.NaN(), false},
+		{"BTC-USD", 100, true},
+		{"BTC-USD", 100.5, false},
+		{"BTC-USD", 100.9, false},
+		{"BTC-USD", 101.5, true},
+		{"BTC-USD", 100.6, false},
+		{"ETH-USD", 10, true},
+		{"BTC-USD", 99, true},
+	}
+	for _, test := range tests {
+		result := o.changed(utils.VWAPSnapshot{Pair: test.pair, VWAP: test.vwap})
+		if result != test.expected {
+			t.Errorf("%s at %v: expected %t got %t", test.pair, test.vwap, test.expected, result)
+		}
+	}
+}
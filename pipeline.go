@@ -0,0 +1,211 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/decimal"
+	"CoinbaseMatchesVWAP/metrics"
+	"CoinbaseMatchesVWAP/model"
+	"CoinbaseMatchesVWAP/utils"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// overflowBlock - a full queue blocks reading until the worker of its trading pair catches up, no match is lost
+	overflowBlock = "block"
+	// overflowDropNewest - a match arriving at a full queue is dropped
+	overflowDropNewest = "drop-newest"
+	// overflowDropOldest - the oldest match of a full queue is dropped to make room for the new one
+	overflowDropOldest = "drop-oldest"
+)
+
+// match - a decoded match and the raw message it was decoded from
+type match struct {
+	dataPoint model.DataPoint
+	message   []byte
+	// subscription - number of subscriptions acknowledged before match was received
+	subscription uint64
+}
+
+// pipeline - routes matches to a worker goroutine per trading pair, so trading pairs are processed in parallel,
+// while matches of each trading pair are processed in order
+type pipeline struct {
+	aggregator *utils.Aggregator
+	dead       *deadLetters
+	// queueSize - capacity of queue of each worker
+	queueSize int
+	// overflow - handling of matches arriving at a full queue, e.g. overflowBlock
+	overflow string
+	// workers - queue of each trading pair, a worker is started with it on first match
+	workers map[string]chan match
+	wg      sync.WaitGroup
+	// errs - first error of a worker, e.g. too many dead letters
+	errs chan error
+	// subscription - number of subscriptions acknowledged so far, only used by reader
+	subscription uint64
+}
+
+// newPipeline - initializes a pipeline adding matches to aggregator
+func newPipeline(aggregator *utils.Aggregator, dead *deadLetters, queueSize int, overflow string) *pipeline {
+	if queueSize <= 0 {
+		queueSize = model.DefaultQueueSize
+	}
+	if overflow == "" {
+		overflow = overflowBlock
+	}
+	return &pipeline{
+		aggregator: aggregator,
+		dead:       dead,
+		queueSize:  queueSize,
+		overflow:   overflow,
+		workers:    map[string]chan match{},
+		errs:       make(chan error, 1),
+	}
+}
+
+// dispatch - queues a match for the worker of its trading pair, applying overflow policy if queue is full
+func (p *pipeline) dispatch(m match) {
+	m.subscription = p.subscription
+	queue, ok := p.workers[m.dataPoint.ProductID]
+	if !ok {
+		queue = make(chan match, p.queueSize)
+		p.workers[m.dataPoint.ProductID] = queue
+		p.wg.Add(1)
+		go p.work(queue)
+	}
+	if !p.enqueue(queue, m) {
+		metrics.QueueOverflows.Inc()
+	}
+}
+
+// rebaseline - makes next match received of each trading pair a new sequence baseline, never blocks.
+// Called when a subscription is acknowledged, e.g. after reconnecting, so trades missed meanwhile are not gaps.
+func (p *pipeline) rebaseline() {
+	p.subscription++
+}
+
+// enqueue - adds a match to a queue according to overflow policy, returns false if a match was dropped
+func (p *pipeline) enqueue(queue chan match, m match) bool {
+	switch p.overflow {
+	case overflowDropNewest:
+		select {
+		case queue <- m:
+			return true
+		default:
+			return false
+		}
+	case overflowDropOldest:
+		dropped := false
+		for {
+			select {
+			case queue <- m:
+				return !dropped
+			default:
+			}
+			// worker may have taken the oldest match meanwhile
+			select {
+			case <-queue:
+				dropped = true
+			default:
+			}
+		}
+	default:
+		queue <- m
+		return true
+	}
+}
+
+// work - processes matches of a trading pair until its queue is closed
+func (p *pipeline) work(queue chan match) {
+	defer p.wg.Done()
+	var subscription uint64
+	for m := range queue {
+		// first match received since a subscription was acknowledged starts a new sequence baseline,
+		// even if matches queued before it were dropped
+		if m.subscription != subscription {
+			subscription = m.subscription
+			p.aggregator.Sequences.Rebaseline(m.dataPoint.ProductID)
+		}
+		err := p.process(m)
+		if err != nil {
+			select {
+			case p.errs <- err:
+			default:
+			}
+		}
+	}
+}
+
+// process - adds a match to aggregator, skipping it as dead letter if it can't be parsed.
+// Returns an error once there are too many dead letters.
+func (p *pipeline) process(m match) error {
+	dataPoint := m.dataPoint
+
+	// check for missing, duplicate and reordered matches
+	if !p.aggregator.CheckSequence(dataPoint) {
+		return nil
+	}
+
+	// time of transaction is used by time based windows, fall back to time of arrival
+	tradeTime := dataPoint.Time
+	if tradeTime.IsZero() {
+		tradeTime = time.Now()
+	}
+
+	// add data point to VWAP util based on Trading Pair in message (Product ID),
+	// unknown products are rejected only with UNKNOWN_PRODUCT_POLICY "error"
+	err := p.add(dataPoint, tradeTime)
+	if err != nil {
+		return p.dead.Add(m.message, err)
+	}
+	metrics.MessagesParsed.Inc()
+	if !dataPoint.Time.IsZero() {
+		metrics.ProcessingLatency.Observe(time.Since(dataPoint.Time).Seconds())
+	}
+	return nil
+}
+
+// add - parses price and volume of transaction (size), exactly as written in decimal mode, and adds them to aggregator
+func (p *pipeline) add(dataPoint model.DataPoint, tradeTime time.Time) error {
+	if p.aggregator.DecimalMode() {
+		price, err := decimal.Parse(dataPoint.Price)
+		if err != nil {
+			return fmt.Errorf("invalid price: %w", err)
+		}
+		size, err := decimal.Parse(dataPoint.Size)
+		if err != nil {
+			return fmt.Errorf("invalid size: %w", err)
+		}
+		return p.aggregator.AddDecimalAt(dataPoint.ProductID, price, size, tradeTime)
+	}
+
+	price, err := strconv.ParseFloat(dataPoint.Price, 64)
+	if err != nil {
+		return fmt.Errorf("invalid price: %w", err)
+	}
+	size, err := strconv.ParseFloat(dataPoint.Size, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size: %w", err)
+	}
+	return p.aggregator.AddAt(dataPoint.ProductID, price, size, tradeTime)
+}
+
+// close - stops workers after they processed all queued matches, returns first error of a worker
+func (p *pipeline) close() error {
+	for _, queue := range p.workers {
+		close(queue)
+	}
+	p.wg.Wait()
+	return p.err()
+}
+
+// err - returns first error of a worker, nil if there is none
+func (p *pipeline) err() error {
+	select {
+	case err := <-p.errs:
+		return err
+	default:
+		return nil
+	}
+}
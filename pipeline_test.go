@@ -0,0 +1,240 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"CoinbaseMatchesVWAP/utils"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestPipeline_Order - tests that matches of several trading pairs are processed in parallel, keeping order of each trading pair
+func TestPipeline_Order(t *testing.T) {
+	pairs := []string{"BTC-USD", "ETH-USD", "ETH-BTC", "LTC-USD", "SOL-USD"}
+	const trades = 50
+	aggregator := utils.NewAggregator(model.Config{TradePairs: pairs, Window: 1000})
+	read := make(chan []byte)
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{}, 4, ""))
+	}()
+
+	for i := 1; i <= trades; i++ {
+		for _, pair := range pairs {
+			read <- []byte(fmt.Sprintf(`{"type":"match","trade_id":%d,"sequence":%d,"size":"1","price":"%d","product_id":"%s"}`, i, i, i, pair))
+		}
+	}
+	close(read)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("startRead did not stop after read channel was closed")
+	}
+
+	for _, pair := range pairs {
+		stats := aggregator.Sequences.Stats(pair)
+		if stats != (utils.SequenceStats{}) {
+			t.Errorf("expected matches of %s in order got %+v", pair, stats)
+		}
+		snapshot, _ := aggregator.PairSnapshot(pair)
+		if snapshot.Trades != trades {
+			t.Errorf("expected %d trades of %s got %d", trades, pair, snapshot.Trades)
+		}
+	}
+}
+
+// TestPipeline_enqueue - tests overflow policies of a full queue
+func TestPipeline_enqueue(t *testing.T) {
+	newMatch := func(tradeID int64) match {
+		return match{dataPoint: model.DataPoint{TradeID: tradeID}}
+	}
+
+	// newest match is dropped
+	p := newPipeline(nil, nil, 2, overflowDropNewest)
+	queue := make(chan match, 2)
+	for i := int64(1); i <= 3; i++ {
+		added := p.enqueue(queue, newMatch(i))
+		if added != (i <= 2) {
+			t.Errorf("match %d: expected added %t got %t", i, i <= 2, added)
+		}
+	}
+	if first := <-queue; first.dataPoint.TradeID != 1 {
+		t.Errorf("expected oldest match %d got %d", 1, first.dataPoint.TradeID)
+	}
+
+	// oldest match is dropped
+	p = newPipeline(nil, nil, 2, overflowDropOldest)
+	queue = make(chan match, 2)
+	for i := int64(1); i <= 3; i++ {
+		added := p.enqueue(queue, newMatch(i))
+		if added != (i <= 2) {
+			t.Errorf("match %d: expected added %t got %t", i, i <= 2, added)
+		}
+	}
+	if first := <-queue; first.dataPoint.TradeID != 2 {
+		t.Errorf("expected oldest match %d got %d", 2, first.dataPoint.TradeID)
+	}
+
+	// full queue blocks until a match is taken
+	p = newPipeline(nil, nil, 1, overflowBlock)
+	queue = make(chan match, 1)
+	p.enqueue(queue, newMatch(1))
+	added := make(chan bool)
+	go func() {
+		added <- p.enqueue(queue, newMatch(2))
+	}()
+	select {
+	case <-added:
+		t.Fatal("expected enqueue to block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-queue
+	if !<-added {
+		t.Error("expected match to be added once queue had room")
+	}
+}
+
+// TestPipeline_WorkerError - tests that startRead stops once a worker reports too many dead letters
+func TestPipeline_WorkerError(t *testing.T) {
+	aggregator := utils.NewAggregator(model.Config{TradePairs: []string{"BTC-USD"}, Window: 200})
+	read := make(chan []byte)
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{threshold: 1}, 0, ""))
+	}()
+
+	// matches with invalid prices are parsed by worker of BTC-USD
+	for i := 1; i <= 2; i++ {
+		select {
+		case read <- []byte(fmt.Sprintf(`{"type":"match","trade_id":%d,"sequence":%d,"size":"1","price":"invalid","product_id":"BTC-USD"}`, i, i)):
+		case err := <-result:
+			t.Fatalf("startRead stopped before all matches were sent: %v", err)
+		}
+	}
+	close(read)
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("expected feed considered broken error, got nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("startRead did not stop")
+	}
+}
+
+// TestPipeline_Reconnect - tests that trades missed while reconnecting don't trigger another resubscribe
+func TestPipeline_Reconnect(t *testing.T) {
+	aggregator := utils.NewAggregator(model.Config{TradePairs: []string{"BTC-USD"}, Window: 200, SequencePolicy: utils.SequencePolicyResubscribe})
+	resubscribes := 0
+	aggregator.OnResubscribe = func(pair string) {
+		resubscribes++
+	}
+	read := make(chan []byte)
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{}, 0, ""))
+	}()
+
+	messages := []string{
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`,
+		`{"type":"match","trade_id":1,"sequence":1,"size":"1","price":"100","product_id":"BTC-USD"}`,
+		`{"type":"match","trade_id":2,"sequence":2,"size":"1","price":"100","product_id":"BTC-USD"}`,
+		// reconnected, trades 3 to 9 happened meanwhile
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`,
+		`{"type":"match","trade_id":10,"sequence":10,"size":"1","price":"100","product_id":"BTC-USD"}`,
+		`{"type":"match","trade_id":11,"sequence":11,"size":"1","price":"100","product_id":"BTC-USD"}`,
+	}
+	for _, message := range messages {
+		read <- []byte(message)
+	}
+	close(read)
+	err := <-result
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	if resubscribes != 0 {
+		t.Errorf("expected %d resubscribes got %d", 0, resubscribes)
+	}
+	if stats := aggregator.Sequences.Stats("BTC-USD"); stats.Gaps != 0 {
+		t.Errorf("expected %d gaps got %d", 0, stats.Gaps)
+	}
+}
+
+// TestPipeline_add - tests that matches are parsed as exact decimals only in decimal mode
+func TestPipeline_add(t *testing.T) {
+	dataPoint := model.DataPoint{ProductID: "BTC-USD", Price: "100.1", Size: "2"}
+	for _, decimalMode := range []bool{false, true} {
+		aggregator := utils.NewAggregator(model.Config{TradePairs: []string{"BTC-USD"}, Window: 200, DecimalMode: decimalMode})
+		p := newPipeline(aggregator, &deadLetters{}, 0, "")
+		err := p.add(dataPoint, time.Now())
+		if err != nil {
+			t.Fatalf("decimal mode %t: expected no error got %v", decimalMode, err)
+		}
+
+		snapshot, _ := aggregator.PairSnapshot("BTC-USD")
+		if snapshot.Trades != 1 || snapshot.MaxPrice != 100.1 {
+			t.Errorf("decimal mode %t: expected trade at %v got %+v", decimalMode, 100.1, snapshot)
+		}
+		if exact := snapshot.ExactVWAP != ""; exact != decimalMode {
+			t.Errorf("decimal mode %t: expected exact VWAP %t got %q", decimalMode, decimalMode, snapshot.ExactVWAP)
+		}
+	}
+
+	p := newPipeline(utils.NewAggregator(model.Config{TradePairs: []string{"BTC-USD"}, Window: 200}), &deadLetters{}, 0, "")
+	err := p.add(model.DataPoint{ProductID: "BTC-USD", Price: "invalid", Size: "2"}, time.Now())
+	if err == nil {
+		t.Error("expected invalid price error got nil")
+	}
+}
+
+// TestPipeline_RebaselineFullQueue - tests that a subscription is handled without waiting for a full queue with a drop policy
+func TestPipeline_RebaselineFullQueue(t *testing.T) {
+	aggregator := utils.NewAggregator(model.Config{TradePairs: []string{"BTC-USD"}, Window: 200})
+	// worker of BTC-USD is held while adding its first match
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	aggregator.OnUpdate(func(snapshot utils.VWAPSnapshot) {
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	read := make(chan []byte)
+	result := make(chan error)
+	go func() {
+		result <- startRead(read, newPipeline(aggregator, &deadLetters{}, 1, overflowDropNewest))
+	}()
+	send := func(message string) {
+		select {
+		case read <- []byte(message):
+		case <-time.After(time.Second):
+			t.Fatalf("reader blocked on %s", message)
+		}
+	}
+
+	send(`{"type":"match","trade_id":1,"sequence":1,"size":"1","price":"100","product_id":"BTC-USD"}`)
+	<-entered
+	// queue is full, trade 3 is dropped
+	send(`{"type":"match","trade_id":2,"sequence":2,"size":"1","price":"100","product_id":"BTC-USD"}`)
+	send(`{"type":"match","trade_id":3,"sequence":3,"size":"1","price":"100","product_id":"BTC-USD"}`)
+	// reconnected, trades 4 to 9 happened meanwhile
+	send(`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`)
+	close(release)
+	send(`{"type":"match","trade_id":10,"sequence":10,"size":"1","price":"100","product_id":"BTC-USD"}`)
+	send(`{"type":"match","trade_id":11,"sequence":11,"size":"1","price":"100","product_id":"BTC-USD"}`)
+	close(read)
+	err := <-result
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	if stats := aggregator.Sequences.Stats("BTC-USD"); stats.Gaps != 0 {
+		t.Errorf("expected %d gaps got %d", 0, stats.Gaps)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"CoinbaseMatchesVWAP/utils"
+	"CoinbaseMatchesVWAP/websocketClient"
+	"log"
+	"os"
+	"time"
+)
+
+// configPollInterval - interval configuration file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// configWatcher - reloads configuration when its file changes or on SIGHUP.
+// Invalid configurations are rejected, keeping the previous one.
+type configWatcher struct {
+	path     string
+	interval time.Duration
+	// current - latest valid configuration
+	current model.Config
+	// modTime and size - state of configuration file when last loaded
+	modTime time.Time
+	size    int64
+	// apply - applies a new valid configuration
+	apply func(previous, next model.Config)
+}
+
+// newConfigWatcher - initializes a watcher of a configuration file, loaded as current
+func newConfigWatcher(path string, current model.Config, apply func(previous, next model.Config)) *configWatcher {
+	w := &configWatcher{
+		path:     path,
+		interval: configPollInterval,
+		current:  current,
+		apply:    apply,
+	}
+	w.changed()
+	return w
+}
+
+// run - polls configuration file for changes and reloads it on change or signal, until done is closed
+func (w *configWatcher) run(reload <-chan os.Signal, done <-chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-reload:
+			log.Println("reloading configuration on signal")
+			w.changed()
+			w.reload()
+		case <-ticker.C:
+			if w.changed() {
+				log.Println("reloading configuration after file changed")
+				w.reload()
+			}
+		}
+	}
+}
+
+// changed - reports whether configuration file changed since last check
+func (w *configWatcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		// file may be replaced by an editor, checked again on next tick
+		return false
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false
+	}
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return true
+}
+
+// reload - loads and validates configuration file, applies it if valid
+func (w *configWatcher) reload() {
+	next, err := loadConfig(w.path)
+	if err != nil {
+		log.Printf("configuration reload rejected, keeping previous configuration: %v", err)
+		return
+	}
+	err = validateConfig(next)
+	if err != nil {
+		log.Printf("configuration reload rejected, keeping previous configuration: %v", err)
+		return
+	}
+
+	previous := w.current
+	w.current = next
+	w.apply(previous, next)
+}
+
+// applyConfig - applies a reloaded configuration to aggregator and subscriptions of client
+func applyConfig(previous, next model.Config, aggregator *utils.Aggregator, client websocketClient.SocketClient) {
+	added, removed := aggregator.Reconfigure(next)
+
+	// subscribe and unsubscribe only what changed, on the existing connection
+	subscribe, unsubscribe := websocketClient.NewSubscriptions(next.GetChannels()...).Diff(websocketClient.NewSubscriptions(previous.GetChannels()...))
+	if len(unsubscribe) > 0 {
+		err := client.Unsubscribe(unsubscribe...)
+		if err != nil {
+			log.Printf("failed to unsubscribe: %v", err)
+		}
+	}
+	if len(subscribe) > 0 {
+		err := client.Subscribe(subscribe...)
+		if err != nil {
+			log.Printf("failed to subscribe: %v", err)
+		}
+	}
+	log.Printf("configuration reloaded: added %v, removed %v", added, removed)
+
+	// connections and files are only set up on start
+	if previous.SocketAddress != next.SocketAddress || previous.HTTPAddress != next.HTTPAddress ||
+		previous.RecordFile != next.RecordFile || previous.ReplayFile != next.ReplayFile || previous.ReplaySpeed != next.ReplaySpeed ||
+		previous.StreamPolicy != next.StreamPolicy || previous.StreamBuffer != next.StreamBuffer ||
+		keepalivePolicy(previous) != keepalivePolicy(next) ||
+		previous.QuarantineFile != next.QuarantineFile || previous.DeadLetterThreshold != next.DeadLetterThreshold ||
+		previous.QueueSize != next.QueueSize || previous.OverflowPolicy != next.OverflowPolicy ||
+		previous.OutputMode != next.OutputMode || previous.OutputInterval != next.OutputInterval || previous.OutputThreshold != next.OutputThreshold {
+		log.Println("SOCKET_ADDRESS, HTTP_ADDRESS, RECORD_FILE, REPLAY_FILE, REPLAY_SPEED, STREAM_POLICY, STREAM_BUFFER, keepalive, " +
+			"QUARANTINE_FILE, DEAD_LETTER_THRESHOLD, QUEUE_SIZE, OVERFLOW_POLICY and OUTPUT_* changes require a restart")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfig - writes a configuration file for testing purposes
+func writeConfig(t *testing.T, path, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+// TestConfigWatcher_Reload - tests that valid configurations are applied and invalid ones rejected
+func TestConfigWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.json")
+	writeConfig(t, path, `{"TRADE_PAIRS": ["BTC-USD"], "SOCKET_ADDRESS": "test", "WINDOW": 200}`)
+	current, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	var applied []model.Config
+	watcher := newConfigWatcher(path, current, func(previous, next model.Config) {
+		applied = append(applied, next)
+	})
+
+	// no WINDOW for ETH-USD
+	writeConfig(t, path, `{"TRADE_PAIRS": ["BTC-USD", "ETH-USD"], "SOCKET_ADDRESS": "test", "PAIRS": {"BTC-USD": {"WINDOW": 200}}}`)
+	watcher.reload()
+	if len(applied) != 0 || len(watcher.current.TradePairs) != 1 {
+		t.Fatalf("expected invalid configuration to be rejected, applied %v", applied)
+	}
+
+	writeConfig(t, path, `{"TRADE_PAIRS": ["BTC-USD", "ETH-USD"], "SOCKET_ADDRESS": "test", "WINDOW": 200}`)
+	watcher.reload()
+	if len(applied) != 1 || len(watcher.current.TradePairs) != 2 {
+		t.Errorf("expected configuration with %d trading pairs to be applied, applied %v", 2, applied)
+	}
+}
+
+// TestConfigWatcher_Run - tests that configuration is reloaded when file changes and on signal
+func TestConfigWatcher_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.json")
+	writeConfig(t, path, `{"TRADE_PAIRS": ["BTC-USD"], "SOCKET_ADDRESS": "test", "WINDOW": 200}`)
+
+	applied := make(chan model.Config, 2)
+	watcher := newConfigWatcher(path, model.Config{}, func(previous, next model.Config) {
+		applied <- next
+	})
+	watcher.interval = 10 * time.Millisecond
+	reload := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go watcher.run(reload, done)
+
+	// unchanged file is not reloaded
+	select {
+	case next := <-applied:
+		t.Fatalf("unexpected reload of %v", next)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeConfig(t, path, `{"TRADE_PAIRS": ["BTC-USD", "ETH-USD"], "SOCKET_ADDRESS": "test", "WINDOW": 200}`)
+	select {
+	case next := <-applied:
+		if len(next.TradePairs) != 2 {
+			t.Errorf("expected %d trading pairs got %v", 2, next.TradePairs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("file change was not reloaded")
+	}
+
+	reload <- os.Interrupt
+	select {
+	case <-applied:
+	case <-time.After(time.Second):
+		t.Fatal("signal did not reload configuration")
+	}
+}
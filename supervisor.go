@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// supervisor - runs long-lived tasks under a shared context, cancelled as soon as any task returns or Stop is called.
+// Wait returns the first error, like an errgroup.
+type supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	err    error
+}
+
+// newSupervisor - initializes a supervisor with a context derived from parent
+func newSupervisor(parent context.Context) *supervisor {
+	ctx, cancel := context.WithCancel(parent)
+	return &supervisor{ctx: ctx, cancel: cancel}
+}
+
+// Context - returns context shared by all tasks
+func (s *supervisor) Context() context.Context {
+	return s.ctx
+}
+
+// Go - runs a named task, stopping all other tasks once it returns
+func (s *supervisor) Go(name string, task func(ctx context.Context) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := task(s.ctx)
+		if err != nil {
+			log.Printf("task stopped: name=%s err=%v", name, err)
+		}
+		s.Stop(err)
+	}()
+}
+
+// Stop - cancels context of all tasks, recording err as cause if it is the first error
+func (s *supervisor) Stop(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.cancel()
+}
+
+// Wait - waits for all tasks to return, returns the first error
+func (s *supervisor) Wait() error {
+	s.wg.Wait()
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
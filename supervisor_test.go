@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSupervisor - tests that a returning task cancels all others, and Wait returns the first error
+func TestSupervisor(t *testing.T) {
+	expected := errors.New("failed")
+	s := newSupervisor(context.Background())
+
+	for i := 0; i < 3; i++ {
+		s.Go("waiting", func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+	}
+	s.Go("failing", func(ctx context.Context) error {
+		return expected
+	})
+
+	result := make(chan error)
+	go func() {
+		result <- s.Wait()
+	}()
+	select {
+	case err := <-result:
+		if err != expected {
+			t.Errorf("expected %v got %v", expected, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("tasks were not stopped")
+	}
+}
+
+// TestSupervisor_Parent - tests that cancelling parent context stops all tasks without error
+func TestSupervisor_Parent(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	s := newSupervisor(parent)
+	s.Go("waiting", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	cancel()
+	err := s.Wait()
+	if err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+}
@@ -1,41 +1,399 @@
 package utils
 
 import (
+	"CoinbaseMatchesVWAP/decimal"
 	"CoinbaseMatchesVWAP/model"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Aggregator - aggregates trade data for multiple trade pairs
+const (
+	// UnknownProductDrop - trades of products which are not configured are dropped and counted
+	UnknownProductDrop = "drop"
+	// UnknownProductCreate - slide windows are created for products which are not configured, using global settings
+	UnknownProductCreate = "create"
+	// UnknownProductError - trades of products which are not configured are rejected with ErrUnknownProduct
+	UnknownProductError = "error"
+)
+
+// ErrUnknownProduct - trade of a product which is not configured was rejected
+var ErrUnknownProduct = errors.New("unknown product")
+
+// Aggregator - aggregates trade data for multiple trade pairs. It is safe for concurrent use.
+// Each trading pair is locked separately, so adding a trade only waits for readers of the same trading pair.
 type Aggregator struct {
-	Utils        map[string]*VWAPUtil
+	// mu - guards the set of trading pairs and configuration, which are replaced on reload.
+	// Trades are added holding it for reading, state of each trading pair is guarded by its PairWindows.
+	mu sync.RWMutex
+	// windows - slide windows of each trading pair
+	windows      map[string]*PairWindows
 	tradingPairs []string
 	config       model.Config
+	// Sequences - tracks sequence of matches received for each trading pair
+	Sequences *SequenceTracker
+	// Status - tracks subscription status of each trading pair
+	Status *StatusTracker
+	// OnResubscribe - called when a sequence gap is detected and SEQUENCE_POLICY is "resubscribe",
+	// or when a trading pair becomes stale and STALE_POLICY is "reconnect"
+	OnResubscribe func(pair string)
+	// listeners - called with state of trading pair after each trade added
+	listeners []func(snapshot VWAPSnapshot)
+	// dropped - trades of unknown products dropped per product
+	dropped map[string]uint64
+	// removed - trading pairs removed by Reconfigure, their late trades are dropped whatever UNKNOWN_PRODUCT_POLICY is
+	removed map[string]bool
 }
 
 // NewAggregator - initializes a new aggregator based on a config object
 func NewAggregator(config model.Config) *Aggregator {
-	// initialize VWAP Utils for each trade pair in configuration
-	utils := map[string]*VWAPUtil{}
-	for _, pair := range config.TradePairs {
-		utils[pair] = NewVWAPUtil(config.Window, pair)
+	// initialize VWAP utils for each slide window of each trade pair in configuration
+	tradingPairs := config.GetTradePairs()
+	windows := map[string]*PairWindows{}
+	for _, pair := range tradingPairs {
+		windows[pair] = newPairWindows(config, pair)
 	}
+	status := NewStatusTracker(tradingPairs)
+	status.SetHeartbeatTimeout(config.GetHeartbeatTimeout())
+	status.SetStaleAfter(time.Duration(config.StaleAfter))
 	return &Aggregator{
-		Utils:        utils,
-		tradingPairs: config.TradePairs,
+		windows:      windows,
+		tradingPairs: tradingPairs,
 		config:       config,
+		Sequences:    NewSequenceTracker(),
+		Status:       status,
+		dropped:      map[string]uint64{},
+		removed:      map[string]bool{},
+	}
+}
+
+// CheckSequence - checks sequence of a match and applies configured SEQUENCE_POLICY to anomalies.
+// Returns false if match is a duplicate and must not be added to slide window.
+func (ag *Aggregator) CheckSequence(dataPoint model.DataPoint) bool {
+	result := ag.Sequences.Check(dataPoint)
+	if result == SequenceOK {
+		return true
+	}
+
+	ag.mu.RLock()
+	policy := ag.config.SequencePolicy
+	windows, known := ag.windows[dataPoint.ProductID]
+	onResubscribe := ag.OnResubscribe
+	ag.mu.RUnlock()
+	if policy == "" {
+		policy = SequencePolicyLog
+	}
+
+	if policy != SequencePolicyIgnore {
+		log.Printf("sequence %s: product_id=%s sequence=%d trade_id=%d", result, dataPoint.ProductID, dataPoint.Sequence, dataPoint.TradeID)
+	}
+
+	if result == SequenceGap {
+		switch policy {
+		case SequencePolicyDegrade:
+			if known {
+				windows.MarkDegraded()
+			}
+		case SequencePolicyResubscribe:
+			if onResubscribe != nil {
+				onResubscribe(dataPoint.ProductID)
+			}
+		}
+	}
+
+	return result != SequenceDuplicate
+}
+
+// CheckStale - logs trading pairs which became stale since last check and applies configured STALE_POLICY.
+// Returns trading pairs which became stale.
+func (ag *Aggregator) CheckStale() []PairStatus {
+	ag.mu.RLock()
+	policy := ag.config.StalePolicy
+	onResubscribe := ag.OnResubscribe
+	ag.mu.RUnlock()
+
+	stale := ag.Status.CheckStale()
+	for _, status := range stale {
+		log.Printf("stale: product_id=%s reason=%q", status.Pair, status.Reason)
+	}
+	if policy != StalePolicyReconnect || onResubscribe == nil {
+		return stale
+	}
+	// only heartbeats tell a broken feed from a quiet trading pair, a single reconnect resubscribes all trading pairs
+	for _, status := range stale {
+		if status.HeartbeatStale {
+			onResubscribe(status.Pair)
+			break
+		}
+	}
+	return stale
+}
+
+// Add - adds a trade to all slide windows of a trading pair, at current time, and notifies listeners of the update.
+// Trades of products which are not configured are handled according to UNKNOWN_PRODUCT_POLICY.
+func (ag *Aggregator) Add(pair string, price, volume float64) error {
+	return ag.AddAt(pair, price, volume, time.Now())
+}
+
+// AddAt - adds a trade to all slide windows of a trading pair and notifies listeners of the update
+func (ag *Aggregator) AddAt(pair string, price, volume float64, at time.Time) error {
+	return ag.update(pair, func(windows *PairWindows) {
+		windows.AddAt(price, volume, at)
+	})
+}
+
+// AddDecimalAt - adds a trade to all slide windows of a trading pair, exactly in decimal mode, and notifies listeners of the update
+func (ag *Aggregator) AddDecimalAt(pair string, price, volume decimal.Decimal, at time.Time) error {
+	return ag.update(pair, func(windows *PairWindows) {
+		windows.AddDecimalAt(price, volume, at)
+	})
+}
+
+// DecimalMode - reports whether trades are accumulated as exact decimals, DECIMAL_MODE of current configuration
+func (ag *Aggregator) DecimalMode() bool {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	return ag.config.DecimalMode
+}
+
+// Dropped - returns number of trades of unknown products dropped, per product
+func (ag *Aggregator) Dropped() map[string]uint64 {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	dropped := map[string]uint64{}
+	for pair, count := range ag.dropped {
+		dropped[pair] = count
 	}
+	return dropped
+}
+
+// update - applies add to the slide windows of a trading pair and notifies listeners of the update
+func (ag *Aggregator) update(pair string, add func(windows *PairWindows)) error {
+	// holding mu for reading keeps the trading pair from being replaced on reload, without blocking other trading pairs
+	ag.mu.RLock()
+	windows, ok := ag.windows[pair]
+	if !ok {
+		ag.mu.RUnlock()
+		return ag.updateUnknown(pair, add)
+	}
+	add(windows)
+	listeners := ag.listeners
+	ag.mu.RUnlock()
+
+	ag.notify(windows, listeners)
+	return nil
+}
+
+// updateUnknown - applies add to the slide windows of a trading pair which was not found, according to UNKNOWN_PRODUCT_POLICY
+func (ag *Aggregator) updateUnknown(pair string, add func(windows *PairWindows)) error {
+	ag.mu.Lock()
+	// trading pair may have been created meanwhile
+	windows, ok := ag.windows[pair]
+	if !ok {
+		// product was never configured, or trading pair was removed while its matches were in flight
+		var err error
+		windows, err = ag.unknownProduct(pair)
+		if windows == nil {
+			ag.mu.Unlock()
+			return err
+		}
+	}
+	add(windows)
+	listeners := ag.listeners
+	ag.mu.Unlock()
+
+	ag.notify(windows, listeners)
+	return nil
+}
+
+// notify - calls listeners with state of a trading pair. Listeners are called without holding lock, so they may read from aggregator.
+func (ag *Aggregator) notify(windows *PairWindows, listeners []func(snapshot VWAPSnapshot)) {
+	if len(listeners) == 0 {
+		return
+	}
+	snapshot := ag.snapshot(windows)
+	for _, listener := range listeners {
+		listener(snapshot)
+	}
+}
+
+// unknownProduct - applies configured UNKNOWN_PRODUCT_POLICY to a trade of a product which is not configured.
+// Returns slide windows created for product, nil if trade is not added. Must be called holding mu.
+func (ag *Aggregator) unknownProduct(pair string) (*PairWindows, error) {
+	// matches still in flight for a removed trading pair must not recreate it
+	if ag.removed[pair] {
+		if ag.dropped[pair] == 0 {
+			log.Printf("unknown product: product_id=%s action=drop reason=removed", pair)
+		}
+		ag.dropped[pair]++
+		return nil, nil
+	}
+
+	switch ag.config.UnknownProductPolicy {
+	case UnknownProductCreate:
+		log.Printf("unknown product: product_id=%s action=create", pair)
+		windows := newPairWindows(ag.config, pair)
+		ag.windows[pair] = windows
+		ag.tradingPairs = append(ag.tradingPairs, pair)
+		ag.Status.SetPairs(ag.tradingPairs)
+		return windows, nil
+	case UnknownProductError:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProduct, pair)
+	default:
+		// logged once per product, as all of its trades are dropped
+		if ag.dropped[pair] == 0 {
+			log.Printf("unknown product: product_id=%s action=drop", pair)
+		}
+		ag.dropped[pair]++
+		return nil, nil
+	}
+}
+
+// Reconfigure - applies a new configuration, returns trading pairs added and removed by it.
+// Slide windows of kept trading pairs are rebuilt with new settings, keeping the trades which still fit in them.
+func (ag *Aggregator) Reconfigure(config model.Config) (added, removed []string) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	tradingPairs := config.GetTradePairs()
+	pairs := map[string]*PairWindows{}
+	for _, pair := range tradingPairs {
+		windows := newPairWindows(config, pair)
+		if previous, ok := ag.windows[pair]; ok {
+			windows.replay(previous)
+		} else {
+			added = append(added, pair)
+		}
+		pairs[pair] = windows
+		delete(ag.removed, pair)
+	}
+	for _, pair := range ag.tradingPairs {
+		if _, ok := pairs[pair]; !ok {
+			removed = append(removed, pair)
+		}
+	}
+	// trading pairs created by UNKNOWN_PRODUCT_POLICY "create" may be created again
+	for _, pair := range ag.config.GetTradePairs() {
+		if _, ok := pairs[pair]; !ok {
+			ag.removed[pair] = true
+		}
+	}
+
+	ag.windows = pairs
+	ag.tradingPairs = tradingPairs
+	ag.config = config
+	ag.Status.SetPairs(tradingPairs)
+	ag.Status.SetHeartbeatTimeout(config.GetHeartbeatTimeout())
+	ag.Status.SetStaleAfter(time.Duration(config.StaleAfter))
+	return added, removed
+}
+
+// OnUpdate - registers a listener called with the state of a trading pair after each trade added to it.
+// Listeners are called on the ingestion goroutine and must not block.
+func (ag *Aggregator) OnUpdate(listener func(snapshot VWAPSnapshot)) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.listeners = append(ag.listeners, listener)
+}
+
+// Snapshot - returns current state of all trading pairs, in configured order
+func (ag *Aggregator) Snapshot() []VWAPSnapshot {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+
+	var snapshots []VWAPSnapshot
+	for _, pair := range ag.tradingPairs {
+		snapshots = append(snapshots, ag.snapshot(ag.windows[pair]))
+	}
+	return snapshots
+}
+
+// Pair - returns slide windows of a trading pair, false if trading pair is unknown
+func (ag *Aggregator) Pair(pair string) (*PairWindows, bool) {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	windows, ok := ag.windows[pair]
+	return windows, ok
+}
+
+// PairSnapshot - returns current state of a trading pair, false if trading pair is unknown
+func (ag *Aggregator) PairSnapshot(pair string) (VWAPSnapshot, bool) {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+
+	windows, ok := ag.windows[pair]
+	if !ok {
+		return VWAPSnapshot{}, false
+	}
+	return ag.snapshot(windows), true
+}
+
+// snapshot - returns current state of slide windows of a trading pair, with its subscription status
+func (ag *Aggregator) snapshot(windows *PairWindows) VWAPSnapshot {
+	snapshot := windows.Snapshot()
+	if status, ok := ag.Status.Get(windows.Pair); ok {
+		snapshot.Status = status.Status
+		snapshot.StatusReason = status.Reason
+	}
+	snapshot.Sequence = ag.Sequences.Stats(windows.Pair)
+	return snapshot
+}
+
+// newPairWindows - initializes slide windows of a trading pair using its effective settings
+func newPairWindows(config model.Config, pair string) *PairWindows {
+	pairConfig := config.ForPair(pair)
+	windows := NewPairWindows(pair)
+	for _, window := range pairConfig.Windows {
+		util := newVWAPUtilForWindow(window, pairConfig.CalculationMode, pair)
+		util.SetPrecision(pairConfig.GetPrecision())
+		if config.DecimalMode {
+			// precision of trading pair overrides scale of VWAP
+			scale := config.GetDecimalScale()
+			if pairConfig.Precision != nil {
+				scale = *pairConfig.Precision
+			}
+			// rounding mode is validated with configuration
+			rounding, _ := decimal.ParseRoundingMode(config.DecimalRounding)
+			util.EnableDecimal(int32(scale), rounding)
+		}
+		windows.Windows = append(windows.Windows, util)
+	}
+	windows.SetAlerts(pairConfig.AlertAbove, pairConfig.AlertBelow)
+	return windows
+}
+
+// newVWAPUtilForWindow - initializes a VWAPUtil for a slide window of a trading pair, using calculation mode of trading pair
+func newVWAPUtilForWindow(window model.WindowConfig, mode string, pair string) *VWAPUtil {
+	var util *VWAPUtil
+	if window.WindowType == model.WindowTypeTime {
+		util = NewTimeVWAPUtil(time.Duration(window.WindowDuration), pair)
+	} else {
+		util = NewVWAPUtil(window.Window, pair)
+	}
+	util.SetCalculationMode(mode)
+	return util
 }
 
 // ToString - prints formatted aggregated trade data to output
 func (ag *Aggregator) ToString() string {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+
 	var pairs []string
 
-	// output VWAP for all trading pairs in aggregator
+	// output VWAP for all slide windows of all trading pairs in aggregator
 	for _, pair := range ag.tradingPairs {
-		pairs = append(pairs, ag.Utils[pair].ToString())
+		output := ag.windows[pair].ToString()
+		// VWAP of a rejected or stale trading pair is not updated, explain why
+		if status, ok := ag.Status.Get(pair); ok && (status.Status == StatusRejected || status.Status == StatusStale) {
+			output += fmt.Sprintf(" (%s: %s)", strings.ToUpper(status.Status), status.Reason)
+		}
+		pairs = append(pairs, output)
 	}
 
 	return strings.Join(pairs, "\n")
@@ -43,8 +401,12 @@ func (ag *Aggregator) ToString() string {
 
 // ToOutput - prints formatted aggregated trade data to output
 func (ag *Aggregator) ToOutput() {
+	ag.mu.RLock()
+	clearConsole := ag.config.ClearConsole
+	ag.mu.RUnlock()
+
 	// clears console before printing if configured so
-	if ag.config.ClearConsole == true {
+	if clearConsole == true {
 		cmd := exec.Command("cmd", "/c", "cls")
 		cmd.Stdout = os.Stdout
 		cmd.Run()
@@ -2,7 +2,10 @@ package utils
 
 import (
 	"CoinbaseMatchesVWAP/model"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestNewAggregator - ideal test for function
@@ -18,7 +21,7 @@ func TestNewAggregator(t *testing.T) {
 	if result == nil {
 		t.Error("aggregator is nil")
 	}
-	if len(result.Utils) == 0 {
+	if len(result.windows) == 0 {
 		t.Error("failed to create utils for trading pairs")
 	}
 }
@@ -37,16 +40,16 @@ func TestNewAggregator_NoPairs(t *testing.T) {
 	if result == nil {
 		t.Error("aggregator is nil")
 	}
-	if len(result.Utils) != 0 {
-		t.Errorf("created wrong number of utils: %d", len(result.Utils))
+	if len(result.windows) != 0 {
+		t.Errorf("created wrong number of utils: %d", len(result.windows))
 	}
 }
 
 // TestAggregator_ToString - tests ToString method of Aggregator
 func TestAggregator_ToString(t *testing.T) {
-	expectedValue := `Trading Pair for the latest 1 trades: BTC-USD, VWAP: 1.000000
-Trading Pair for the latest 1 trades: ETH-USD, VWAP: 2.000000
-Trading Pair for the latest 1 trades: ETH-BTC, VWAP: 2.000000`
+	expectedValue := `Trading Pair for the latest 200 trades (1 trades): BTC-USD, VWAP: 1.000000
+Trading Pair for the latest 200 trades (1 trades): ETH-USD, VWAP: 2.000000
+Trading Pair for the latest 200 trades (1 trades): ETH-BTC, VWAP: 2.000000`
 	// initialize a new aggregator with 3 trade pairs
 	pairs := []string{"BTC-USD", "ETH-USD", "ETH-BTC"}
 	config := model.Config{
@@ -58,12 +61,481 @@ Trading Pair for the latest 1 trades: ETH-BTC, VWAP: 2.000000`
 	result := NewAggregator(config)
 
 	// Add a datapoint to the util for each trading pair
-	result.Utils["BTC-USD"].Add(1,2)
-	result.Utils["ETH-BTC"].Add(2,3)
-	result.Utils["ETH-USD"].Add(2,3)
+	result.windows["BTC-USD"].Add(1, 2)
+	result.windows["ETH-BTC"].Add(2, 3)
+	result.windows["ETH-USD"].Add(2, 3)
 
 	str := result.ToString()
 	if str != expectedValue {
 		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
 	}
-}
\ No newline at end of file
+}
+
+// TestNewAggregator_PairWindows - tests that per pair window settings override global window
+func TestNewAggregator_PairWindows(t *testing.T) {
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-BTC"},
+		SocketAddress: "test",
+		Window:        200,
+		Pairs: map[string]model.PairConfig{
+			"ETH-BTC": {
+				WindowType:     model.WindowTypeTime,
+				WindowDuration: model.Duration(5 * time.Minute),
+			},
+		},
+	}
+	result := NewAggregator(config)
+
+	if result.windows["BTC-USD"].Windows[0].window != 200 || result.windows["BTC-USD"].Windows[0].duration != 0 {
+		t.Errorf("expected trade window of %d for BTC-USD", 200)
+	}
+	if result.windows["ETH-BTC"].Windows[0].duration != 5*time.Minute {
+		t.Errorf("expected time window of %s got %s", 5*time.Minute, result.windows["ETH-BTC"].Windows[0].duration)
+	}
+}
+
+// TestAggregator_CheckSequence_Degrade - tests that a gap marks trading pair as degraded in output
+func TestAggregator_CheckSequence_Degrade(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 200 trades (2 trades): BTC-USD, VWAP: 1.666667 (DEGRADED)`
+	config := model.Config{
+		TradePairs:     []string{"BTC-USD"},
+		SocketAddress:  "test",
+		Window:         200,
+		SequencePolicy: SequencePolicyDegrade,
+	}
+	result := NewAggregator(config)
+
+	if !result.CheckSequence(createMatch("BTC-USD", 1, 1)) {
+		t.Error("expected first match to be accepted")
+	}
+	result.windows["BTC-USD"].Add(1, 1)
+
+	// trade 2 is missing
+	if !result.CheckSequence(createMatch("BTC-USD", 3, 3)) {
+		t.Error("expected match after gap to be accepted")
+	}
+	result.windows["BTC-USD"].Add(2, 1)
+
+	// duplicates are rejected
+	if result.CheckSequence(createMatch("BTC-USD", 3, 3)) {
+		t.Error("expected duplicate match to be rejected")
+	}
+
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+}
+
+// TestAggregator_CheckSequence_Resubscribe - tests that a gap triggers resubscribe
+func TestAggregator_CheckSequence_Resubscribe(t *testing.T) {
+	config := model.Config{
+		TradePairs:     []string{"BTC-USD"},
+		SocketAddress:  "test",
+		Window:         200,
+		SequencePolicy: SequencePolicyResubscribe,
+	}
+	result := NewAggregator(config)
+	var resubscribed []string
+	result.OnResubscribe = func(pair string) {
+		resubscribed = append(resubscribed, pair)
+	}
+
+	result.CheckSequence(createMatch("BTC-USD", 1, 1))
+	result.CheckSequence(createMatch("BTC-USD", 2, 2))
+	result.CheckSequence(createMatch("BTC-USD", 5, 5))
+
+	if len(resubscribed) != 1 || resubscribed[0] != "BTC-USD" {
+		t.Errorf("expected a single resubscribe for BTC-USD got %v", resubscribed)
+	}
+}
+
+// TestAggregator_OnUpdate - tests that listeners receive state of trading pair after each trade
+func TestAggregator_OnUpdate(t *testing.T) {
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-USD"},
+		SocketAddress: "test",
+		Window:        200,
+	}
+	result := NewAggregator(config)
+	var updates []VWAPSnapshot
+	result.OnUpdate(func(snapshot VWAPSnapshot) {
+		updates = append(updates, snapshot)
+	})
+
+	result.AddAt("ETH-USD", 2, 3, time.Now())
+	result.AddAt("ETH-USD", 4, 3, time.Now())
+
+	if len(updates) != 2 {
+		t.Fatalf("expected %d updates got %d", 2, len(updates))
+	}
+	if updates[1].Pair != "ETH-USD" || updates[1].Trades != 2 || updates[1].VWAP != 10.0/3 {
+		t.Errorf("unexpected update %+v", updates[1])
+	}
+}
+
+// TestAggregator_Windows - tests that each trade is added to all slide windows of its trading pair
+func TestAggregator_Windows(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 2 trades (2 trades): BTC-USD, VWAP: 2.000000
+Trading Pair for the latest 200 trades (3 trades): BTC-USD, VWAP: 2.333333
+Trading Pair for the latest 1m0s (3 trades): BTC-USD, VWAP: 2.333333`
+	config := model.Config{
+		TradePairs:      []string{"BTC-USD"},
+		SocketAddress:   "test",
+		CalculationMode: model.CalculationModeStandard,
+		Windows: []model.WindowConfig{
+			{Window: 2},
+			{Window: 200},
+			{WindowDuration: model.Duration(time.Minute)},
+		},
+	}
+	result := NewAggregator(config)
+	var updates []VWAPSnapshot
+	result.OnUpdate(func(snapshot VWAPSnapshot) {
+		updates = append(updates, snapshot)
+	})
+
+	at := time.Now()
+	result.AddAt("BTC-USD", 3, 1, at)
+	result.AddAt("BTC-USD", 1, 1, at)
+	result.AddAt("BTC-USD", 3, 1, at)
+
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+
+	// update holds primary window and all windows of trading pair
+	last := updates[len(updates)-1]
+	if last.Window != 2 || len(last.Windows) != 3 || last.Windows[2].WindowDuration != time.Minute {
+		t.Errorf("unexpected update %+v", last)
+	}
+}
+
+// TestNewAggregator_PairBlocks - tests trading pairs defined in PAIRS, disabled trading pairs and per pair precision
+func TestNewAggregator_PairBlocks(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 200 trades (0 trades): BTC-USD, VWAP: NaN
+Trading Pair for the latest 200 trades (1 trades): ETH-BTC, VWAP: 0.0730`
+	disabled := false
+	precision := 4
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-USD"},
+		SocketAddress: "test",
+		Window:        200,
+		Pairs: map[string]model.PairConfig{
+			"ETH-USD": {Enabled: &disabled},
+			"ETH-BTC": {Precision: &precision},
+		},
+	}
+	result := NewAggregator(config)
+	if _, ok := result.windows["ETH-USD"]; ok {
+		t.Error("expected no utils for disabled trading pair")
+	}
+
+	result.AddAt("ETH-BTC", 0.07296, 1, time.Now())
+
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+}
+
+// TestAggregator_Reconfigure - tests that trading pairs are added and removed, and resized windows keep their trades
+func TestAggregator_Reconfigure(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 10 trades (3 trades): BTC-USD, VWAP: 3.333333
+Trading Pair for the latest 10 trades (0 trades): ETH-BTC, VWAP: NaN`
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-USD"},
+		SocketAddress: "test",
+		Window:        3,
+	}
+	result := NewAggregator(config)
+	at := time.Now()
+	for _, price := range []float64{1, 2, 3, 4} {
+		result.AddAt("BTC-USD", price, 1, at)
+	}
+	result.AddAt("ETH-USD", 4, 1, at)
+
+	// grow window, swap ETH-USD for ETH-BTC
+	config.TradePairs = []string{"BTC-USD", "ETH-BTC"}
+	config.Window = 10
+	added, removed := result.Reconfigure(config)
+	if len(added) != 1 || added[0] != "ETH-BTC" || len(removed) != 1 || removed[0] != "ETH-USD" {
+		t.Errorf("expected ETH-BTC added and ETH-USD removed got %v and %v", added, removed)
+	}
+
+	// matches of removed trading pair still in flight are ignored
+	result.AddAt("ETH-USD", 4, 1, at)
+
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+
+	// shrink window, latest trades are kept
+	config.Window = 1
+	result.Reconfigure(config)
+	if result.windows["BTC-USD"].Windows[0].Len() != 1 || result.windows["BTC-USD"].Windows[0].GetVWAP() != 4 {
+		t.Errorf("expected latest trade to be kept got %s", result.windows["BTC-USD"].ToString())
+	}
+}
+
+// TestAggregator_CheckStale - tests that a stale trading pair triggers a reconnect and is output with its reason
+func TestAggregator_CheckStale(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 200 trades (0 trades): BTC-USD, VWAP: NaN (STALE: heartbeat last_trade_id 5 ahead of last match 4)`
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD"},
+		SocketAddress: "test",
+		Window:        200,
+		Channels:      []string{model.ChannelHeartbeat},
+		StalePolicy:   StalePolicyReconnect,
+	}
+	result := NewAggregator(config)
+	var resubscribed []string
+	result.OnResubscribe = func(pair string) {
+		resubscribed = append(resubscribed, pair)
+	}
+
+	result.Status.Subscribed([]string{"BTC-USD"})
+	result.Status.Matched("BTC-USD", 4)
+	result.Status.Heartbeat(model.Heartbeat{ProductID: "BTC-USD", LastTradeID: 5})
+	result.CheckStale()
+	result.CheckStale()
+
+	if len(resubscribed) != 1 || resubscribed[0] != "BTC-USD" {
+		t.Errorf("expected a single resubscribe for BTC-USD got %v", resubscribed)
+	}
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+}
+
+// TestAggregator_CheckStale_Quiet - tests that a trading pair stale without heartbeats doesn't trigger a reconnect
+func TestAggregator_CheckStale_Quiet(t *testing.T) {
+	config := model.Config{
+		TradePairs:    []string{"ETH-BTC"},
+		SocketAddress: "test",
+		Window:        200,
+		StaleAfter:    model.Duration(time.Millisecond),
+		StalePolicy:   StalePolicyReconnect,
+	}
+	result := NewAggregator(config)
+	var resubscribed []string
+	result.OnResubscribe = func(pair string) {
+		resubscribed = append(resubscribed, pair)
+	}
+
+	result.Status.Subscribed([]string{"ETH-BTC"})
+	time.Sleep(5 * time.Millisecond)
+	stale := result.CheckStale()
+
+	if len(stale) != 1 {
+		t.Errorf("expected ETH-BTC to be stale got %+v", stale)
+	}
+	if len(resubscribed) != 0 {
+		t.Errorf("expected no resubscribe got %v", resubscribed)
+	}
+}
+
+// TestAggregator_Add_UnknownProductDrop - tests that trades of unknown products are dropped and counted by default
+func TestAggregator_Add_UnknownProductDrop(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 200 trades (0 trades): BTC-USD, VWAP: NaN`
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD"},
+		SocketAddress: "test",
+		Window:        200,
+	}
+	result := NewAggregator(config)
+
+	for i := 0; i < 2; i++ {
+		err := result.Add("ETH-USD", 1, 1)
+		if err != nil {
+			t.Errorf("expected no error got %v", err)
+		}
+	}
+
+	if result.Dropped()["ETH-USD"] != 2 {
+		t.Errorf("expected %d dropped trades got %d", 2, result.Dropped()["ETH-USD"])
+	}
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+}
+
+// TestAggregator_Add_UnknownProductCreate - tests that slide windows are created for unknown products with global settings
+func TestAggregator_Add_UnknownProductCreate(t *testing.T) {
+	expectedValue := `Trading Pair for the latest 200 trades (0 trades): BTC-USD, VWAP: NaN
+Trading Pair for the latest 200 trades (1 trades): ETH-USD, VWAP: 2.000000`
+	config := model.Config{
+		TradePairs:           []string{"BTC-USD"},
+		SocketAddress:        "test",
+		Window:               200,
+		UnknownProductPolicy: UnknownProductCreate,
+	}
+	result := NewAggregator(config)
+
+	err := result.Add("ETH-USD", 2, 1)
+	if err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+
+	if _, ok := result.PairSnapshot("ETH-USD"); !ok {
+		t.Error("expected ETH-USD to be created")
+	}
+	if len(result.Dropped()) != 0 {
+		t.Errorf("expected no dropped trades got %v", result.Dropped())
+	}
+	str := result.ToString()
+	if str != expectedValue {
+		t.Errorf("expected \n%s \ngot \n%s", expectedValue, str)
+	}
+}
+
+// TestAggregator_Add_UnknownProductCreate_Removed - tests that late trades of a trading pair removed by Reconfigure don't recreate it
+func TestAggregator_Add_UnknownProductCreate_Removed(t *testing.T) {
+	config := model.Config{
+		TradePairs:           []string{"BTC-USD", "ETH-USD"},
+		SocketAddress:        "test",
+		Window:               200,
+		UnknownProductPolicy: UnknownProductCreate,
+	}
+	result := NewAggregator(config)
+
+	config.TradePairs = []string{"BTC-USD"}
+	result.Reconfigure(config)
+	err := result.Add("ETH-USD", 2, 1)
+	if err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+	if _, ok := result.PairSnapshot("ETH-USD"); ok {
+		t.Error("expected ETH-USD not to be recreated")
+	}
+	if result.Dropped()["ETH-USD"] != 1 {
+		t.Errorf("expected %d dropped trades got %v", 1, result.Dropped())
+	}
+
+	// other unknown products are still created
+	err = result.Add("LTC-USD", 2, 1)
+	if _, ok := result.PairSnapshot("LTC-USD"); err != nil || !ok {
+		t.Errorf("expected LTC-USD to be created got %v", err)
+	}
+
+	// trading pair added back is aggregated again
+	config.TradePairs = []string{"BTC-USD", "ETH-USD"}
+	result.Reconfigure(config)
+	result.Add("ETH-USD", 2, 1)
+	if snapshot, _ := result.PairSnapshot("ETH-USD"); snapshot.Trades != 1 {
+		t.Errorf("expected %d trades got %d", 1, snapshot.Trades)
+	}
+}
+
+// TestAggregator_Add_UnknownProductError - tests that trades of unknown products are rejected with ErrUnknownProduct
+func TestAggregator_Add_UnknownProductError(t *testing.T) {
+	config := model.Config{
+		TradePairs:           []string{"BTC-USD"},
+		SocketAddress:        "test",
+		Window:               200,
+		UnknownProductPolicy: UnknownProductError,
+	}
+	result := NewAggregator(config)
+
+	err := result.Add("ETH-USD", 2, 1)
+	if !errors.Is(err, ErrUnknownProduct) {
+		t.Errorf("expected %v got %v", ErrUnknownProduct, err)
+	}
+	if _, ok := result.PairSnapshot("ETH-USD"); ok {
+		t.Error("expected ETH-USD not to be created")
+	}
+
+	// configured products are added as usual
+	err = result.Add("BTC-USD", 2, 1)
+	if err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+}
+
+// TestAggregator_Concurrent - adds trades to several trading pairs while reading and reloading, run with -race to detect data races
+func TestAggregator_Concurrent(t *testing.T) {
+	pairs := []string{"BTC-USD", "ETH-USD", "ETH-BTC", "LTC-USD"}
+	config := model.Config{
+		TradePairs:    pairs,
+		SocketAddress: "test",
+		Window:        200,
+		Windows:       []model.WindowConfig{{Window: 200}, {WindowDuration: model.Duration(time.Hour)}},
+	}
+	result := NewAggregator(config)
+	result.OnUpdate(func(snapshot VWAPSnapshot) {})
+
+	const trades = 100
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+	for _, pair := range pairs {
+		writers.Add(1)
+		go func(pair string) {
+			defer writers.Done()
+			for i := 1; i <= trades; i++ {
+				result.CheckSequence(model.DataPoint{ProductID: pair, Sequence: int64(i), TradeID: int64(i)})
+				result.AddAt(pair, float64(i), 1, time.Now())
+			}
+		}(pair)
+	}
+	for i := 0; i < 2; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				result.Snapshot()
+				result.ToString()
+				result.PairSnapshot("BTC-USD")
+				result.CheckStale()
+			}
+		}()
+	}
+	// reload keeps all trades, as windows are unchanged
+	result.Reconfigure(config)
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	for _, snapshot := range result.Snapshot() {
+		for _, window := range snapshot.AllWindows() {
+			if window.Trades != trades {
+				t.Errorf("expected %d trades in %s window %s got %d", trades, snapshot.Pair, window.WindowLabel(), window.Trades)
+			}
+		}
+	}
+}
+
+// TestAggregator_Sharded - tests that adding a trade to a trading pair does not wait for a reader of another trading pair
+func TestAggregator_Sharded(t *testing.T) {
+	config := model.Config{
+		TradePairs:    []string{"BTC-USD", "ETH-USD"},
+		SocketAddress: "test",
+		Window:        200,
+	}
+	result := NewAggregator(config)
+
+	// simulate a slow reader of ETH-USD
+	eth, _ := result.Pair("ETH-USD")
+	eth.mu.Lock()
+	defer eth.mu.Unlock()
+
+	added := make(chan struct{})
+	go func() {
+		result.Add("BTC-USD", 1, 1)
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("adding a trade to BTC-USD waited for a reader of ETH-USD")
+	}
+}
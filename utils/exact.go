@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/decimal"
+	"CoinbaseMatchesVWAP/model"
+)
+
+// exactState - exact decimal counterpart of the cumulated values of a slide window, kept in decimal mode
+type exactState struct {
+	// cumulatedVolume - total volume of trades in slide window
+	cumulatedVolume decimal.Decimal
+	// cumulatedPV - sum of price * volume of trades in slide window
+	cumulatedPV decimal.Decimal
+	// mode - calculation mode, model.CalculationModeTypical or model.CalculationModeStandard
+	mode string
+	// scale - number of digits after decimal point of VWAP
+	scale int32
+	// rounding - rounding mode of VWAP division
+	rounding decimal.RoundingMode
+}
+
+// add - adds a trade to cumulated values
+func (ex *exactState) add(price, volume decimal.Decimal) {
+	ex.cumulatedVolume = ex.cumulatedVolume.Add(volume)
+	ex.cumulatedPV = ex.cumulatedPV.Add(price.Mul(volume))
+}
+
+// remove - removes a trade from cumulated values
+func (ex *exactState) remove(price, volume decimal.Decimal) {
+	ex.cumulatedVolume = ex.cumulatedVolume.Sub(volume)
+	ex.cumulatedPV = ex.cumulatedPV.Sub(price.Mul(volume))
+}
+
+// vwap - calculates VWAP of slide window from its extreme and last prices, false while slide window has no volume
+func (ex *exactState) vwap(maxPrice, minPrice, lastPrice decimal.Decimal) (decimal.Decimal, bool) {
+	if ex.cumulatedVolume.Sign() == 0 {
+		return decimal.Decimal{}, false
+	}
+
+	if ex.mode == model.CalculationModeStandard {
+		return ex.cumulatedPV.Div(ex.cumulatedVolume, ex.scale, ex.rounding), true
+	}
+
+	// TPV = (max + min + last) / 3 * volume, divided only once to avoid intermediate rounding
+	tpv := maxPrice.Add(minPrice).Add(lastPrice).Mul(ex.cumulatedVolume)
+	return tpv.Div(ex.cumulatedVolume.Mul(decimal.NewFromInt(3)), ex.scale, ex.rounding), true
+}
@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// StatusPending - trading pair was requested but its subscription was not acknowledged yet
+	StatusPending = "pending"
+	// StatusSubscribed - subscription of trading pair was acknowledged by server
+	StatusSubscribed = "subscribed"
+	// StatusRejected - server replied with an error naming trading pair, e.g. an invalid product id
+	StatusRejected = "rejected"
+	// StatusStale - trading pair is subscribed, but no message was received for it lately
+	StatusStale = "stale"
+)
+
+const (
+	// StalePolicyLog - stale trading pairs are logged
+	StalePolicyLog = "log"
+	// StalePolicyReconnect - stale trading pairs are logged and trigger a reconnect
+	StalePolicyReconnect = "reconnect"
+)
+
+// PairStatus - subscription status of a trading pair
+type PairStatus struct {
+	Pair   string
+	Status string
+	// Reason - error reported by server for rejected trading pair, or cause of staleness
+	Reason string
+	// LastMessage - time latest message of trading pair was received
+	LastMessage time.Time
+	// LastTradeID - trade id of latest match received
+	LastTradeID int64
+	// LastHeartbeat - time latest heartbeat of trading pair was received
+	LastHeartbeat time.Time
+	// HeartbeatTradeID and HeartbeatSequence - last_trade_id and sequence of latest heartbeat
+	HeartbeatTradeID  int64
+	HeartbeatSequence int64
+	// HeartbeatStale - staleness is detected by heartbeats, either missing or reporting matches which were not received
+	HeartbeatStale bool
+	// baselineTradeID - last_trade_id of first heartbeat after subscribing, if no match was received before it
+	baselineTradeID int64
+	// reportedStale - staleness was already returned by CheckStale
+	reportedStale bool
+}
+
+// StatusTracker - tracks subscription status of trading pairs, based on messages received from server
+type StatusTracker struct {
+	mu       sync.Mutex
+	statuses map[string]*PairStatus
+	// staleAfter - time without messages after which a subscribed trading pair is stale, 0 if not checked
+	staleAfter time.Duration
+	// heartbeatTimeout - time without heartbeats after which a subscribed trading pair is stale, 0 if heartbeats are not subscribed
+	heartbeatTimeout time.Duration
+	// changed - closed and replaced whenever a status changes
+	changed chan struct{}
+	// now - returns current time, replaced in tests
+	now func() time.Time
+}
+
+// NewStatusTracker - initializes a new status tracker with trading pairs pending
+func NewStatusTracker(pairs []string) *StatusTracker {
+	tracker := &StatusTracker{
+		statuses: map[string]*PairStatus{},
+		changed:  make(chan struct{}),
+		now:      time.Now,
+	}
+	tracker.SetPairs(pairs)
+	return tracker
+}
+
+// SetPairs - tracks trading pairs, keeping status of already tracked ones and dropping the others
+func (st *StatusTracker) SetPairs(pairs []string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	statuses := map[string]*PairStatus{}
+	for _, pair := range pairs {
+		status, ok := st.statuses[pair]
+		if !ok {
+			status = &PairStatus{Pair: pair, Status: StatusPending}
+		}
+		statuses[pair] = status
+	}
+	st.statuses = statuses
+	st.notify()
+}
+
+// SetHeartbeatTimeout - sets time without heartbeats after which a subscribed trading pair is stale, 0 disables heartbeat checks
+func (st *StatusTracker) SetHeartbeatTimeout(timeout time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.heartbeatTimeout = timeout
+}
+
+// SetStaleAfter - sets time without messages after which a subscribed trading pair is stale, 0 disables the check.
+// Trading pairs may go hours without trades, so it is only checked when configured.
+func (st *StatusTracker) SetStaleAfter(staleAfter time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.staleAfter = staleAfter
+}
+
+// Matched - records a match received for a trading pair
+func (st *StatusTracker) Matched(pair string, tradeID int64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if status, ok := st.statuses[pair]; ok {
+		status.LastMessage = st.now()
+		if tradeID > status.LastTradeID {
+			status.LastTradeID = tradeID
+		}
+	}
+}
+
+// Heartbeat - records a heartbeat received for a trading pair
+func (st *StatusTracker) Heartbeat(heartbeat model.Heartbeat) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if status, ok := st.statuses[heartbeat.ProductID]; ok {
+		status.LastMessage = st.now()
+		status.LastHeartbeat = st.now()
+		status.HeartbeatTradeID = heartbeat.LastTradeID
+		status.HeartbeatSequence = heartbeat.Sequence
+		// trades before subscribing were never expected, later heartbeats are compared against this one
+		if status.LastTradeID == 0 && status.baselineTradeID == 0 {
+			status.baselineTradeID = heartbeat.LastTradeID
+		}
+	}
+}
+
+// Subscribed - applies a subscriptions message: listed trading pairs are subscribed,
+// trading pairs which were subscribed but are no longer listed are pending again
+func (st *StatusTracker) Subscribed(pairs []string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	listed := map[string]bool{}
+	for _, pair := range pairs {
+		listed[pair] = true
+	}
+	for pair, status := range st.statuses {
+		switch {
+		case listed[pair]:
+			status.Status = StatusSubscribed
+			status.Reason = ""
+			// staleness is measured from subscription on, trade ids are compared again from next match on
+			status.LastMessage = st.now()
+			status.LastHeartbeat = st.now()
+			status.LastTradeID = 0
+			status.HeartbeatTradeID = 0
+			status.baselineTradeID = 0
+		case status.Status == StatusSubscribed:
+			status.Status = StatusPending
+		}
+	}
+	st.notify()
+}
+
+// Rejected - applies an error message: tracked trading pairs named in it are rejected.
+// Returns rejected trading pairs, empty if message names none.
+func (st *StatusTracker) Rejected(message string) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// trading pairs are matched as whole words, so BTC-USD is not rejected by an error about BTC-USDC
+	named := map[string]bool{}
+	for _, word := range strings.FieldsFunc(message, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}) {
+		named[word] = true
+	}
+
+	var rejected []string
+	for pair, status := range st.statuses {
+		if named[pair] {
+			status.Status = StatusRejected
+			status.Reason = message
+			rejected = append(rejected, pair)
+		}
+	}
+	sort.Strings(rejected)
+	st.notify()
+	return rejected
+}
+
+// Get - returns status of a trading pair, false if trading pair is not tracked
+func (st *StatusTracker) Get(pair string) (PairStatus, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	status, ok := st.statuses[pair]
+	if !ok {
+		return PairStatus{}, false
+	}
+	return st.current(status), true
+}
+
+// current - returns status, reporting subscribed trading pairs as stale if no messages or heartbeats were received lately,
+// or if heartbeats report trades which were not received. Must be called holding mu.
+func (st *StatusTracker) current(status *PairStatus) PairStatus {
+	result := *status
+	if result.Status != StatusSubscribed {
+		return result
+	}
+
+	// latest trade received, or reported by first heartbeat if no match was received since subscribing
+	received := result.LastTradeID
+	if result.baselineTradeID > received {
+		received = result.baselineTradeID
+	}
+
+	now := st.now()
+	switch {
+	case st.heartbeatTimeout > 0 && now.Sub(result.LastHeartbeat) > st.heartbeatTimeout:
+		result.Status = StatusStale
+		result.HeartbeatStale = true
+		result.Reason = fmt.Sprintf("no heartbeat for %s", now.Sub(result.LastHeartbeat).Round(time.Second))
+	case received > 0 && result.HeartbeatTradeID > received:
+		// heartbeats follow the matches they report, so these matches were lost
+		result.Status = StatusStale
+		result.HeartbeatStale = true
+		result.Reason = fmt.Sprintf("heartbeat last_trade_id %d ahead of last match %d", result.HeartbeatTradeID, received)
+	case st.staleAfter > 0 && now.Sub(result.LastMessage) > st.staleAfter:
+		result.Status = StatusStale
+		result.Reason = fmt.Sprintf("no message for %s", now.Sub(result.LastMessage).Round(time.Second))
+	}
+	return result
+}
+
+// CheckStale - returns trading pairs which became stale since last check, each reported once until it recovers
+func (st *StatusTracker) CheckStale() []PairStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var stale []PairStatus
+	for _, status := range st.statuses {
+		current := st.current(status)
+		if current.Status != StatusStale {
+			status.reportedStale = false
+			continue
+		}
+		if !status.reportedStale {
+			status.reportedStale = true
+			stale = append(stale, current)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].Pair < stale[j].Pair
+	})
+	return stale
+}
+
+// WaitSubscribed - waits until all tracked trading pairs are subscribed or rejected, at most timeout or until ctx is cancelled.
+// Returns an error naming rejected trading pairs, and trading pairs still pending once timeout passed or ctx was cancelled.
+func (st *StatusTracker) WaitSubscribed(ctx context.Context, timeout time.Duration) (pending []string, err error) {
+	deadline := time.After(timeout)
+	for {
+		st.mu.Lock()
+		var rejected []string
+		pending = nil
+		for pair, status := range st.statuses {
+			switch status.Status {
+			case StatusRejected:
+				rejected = append(rejected, fmt.Sprintf("%s (%s)", pair, status.Reason))
+			case StatusPending:
+				pending = append(pending, pair)
+			}
+		}
+		changed := st.changed
+		st.mu.Unlock()
+
+		sort.Strings(rejected)
+		sort.Strings(pending)
+		if len(rejected) > 0 {
+			return pending, fmt.Errorf("trading pairs rejected by server: %s", strings.Join(rejected, ", "))
+		}
+		if len(pending) == 0 {
+			return nil, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return pending, nil
+		case <-ctx.Done():
+			return pending, nil
+		}
+	}
+}
+
+// notify - wakes up WaitSubscribed. Must be called holding mu.
+func (st *StatusTracker) notify() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"context"
+	"testing"
+	"time"
+)
+
+// TestStatusTracker - tests status of trading pairs through subscription, rejection and staleness
+func TestStatusTracker(t *testing.T) {
+	now := time.Now()
+	tracker := NewStatusTracker([]string{"BTC-USD", "BTC-USDC", "ETH-USD"})
+	tracker.now = func() time.Time { return now }
+	tracker.SetStaleAfter(time.Minute)
+
+	tracker.Subscribed([]string{"BTC-USD", "ETH-USD"})
+	rejected := tracker.Rejected("Failed to subscribe: BTC-USDC is not a valid product")
+	if len(rejected) != 1 || rejected[0] != "BTC-USDC" {
+		t.Errorf("expected only BTC-USDC to be rejected got %v", rejected)
+	}
+
+	// ETH-USD receives no messages
+	now = now.Add(time.Minute + time.Second)
+	tracker.Matched("BTC-USD", 1)
+
+	for pair, expected := range map[string]string{
+		"BTC-USD":  StatusSubscribed,
+		"BTC-USDC": StatusRejected,
+		"ETH-USD":  StatusStale,
+	} {
+		status, _ := tracker.Get(pair)
+		if status.Status != expected {
+			t.Errorf("%s: expected status %s got %s", pair, expected, status.Status)
+		}
+	}
+
+	// trading pair no longer listed in subscriptions is pending again
+	tracker.Subscribed([]string{"ETH-USD"})
+	if status, _ := tracker.Get("BTC-USD"); status.Status != StatusPending {
+		t.Errorf("expected status %s got %s", StatusPending, status.Status)
+	}
+
+	// quiet trading pairs are not stale unless configured so
+	tracker.SetStaleAfter(0)
+	now = now.Add(time.Hour)
+	if status, _ := tracker.Get("ETH-USD"); status.Status != StatusSubscribed {
+		t.Errorf("expected status %s got %s", StatusSubscribed, status.Status)
+	}
+}
+
+// TestStatusTracker_WaitSubscribed - tests waiting for acknowledgement of all trading pairs
+func TestStatusTracker_WaitSubscribed(t *testing.T) {
+	tracker := NewStatusTracker([]string{"BTC-USD", "ETH-USD"})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.Subscribed([]string{"BTC-USD", "ETH-USD"})
+	}()
+	pending, err := tracker.WaitSubscribed(context.Background(), time.Second)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("expected all trading pairs subscribed got %v, %v", pending, err)
+	}
+
+	// rejected trading pair fails immediately
+	tracker = NewStatusTracker([]string{"BTC-USD", "ZZZ-USD"})
+	tracker.Rejected("Failed to subscribe: ZZZ-USD is not a valid product")
+	_, err = tracker.WaitSubscribed(context.Background(), time.Second)
+	if err == nil {
+		t.Error("expected error naming ZZZ-USD, got nil")
+	}
+
+	// pending trading pairs are returned after timeout
+	tracker = NewStatusTracker([]string{"BTC-USD"})
+	pending, err = tracker.WaitSubscribed(context.Background(), 10*time.Millisecond)
+	if err != nil || len(pending) != 1 {
+		t.Errorf("expected BTC-USD pending got %v, %v", pending, err)
+	}
+
+	// cancelled context stops waiting before timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	pending, err = tracker.WaitSubscribed(ctx, time.Minute)
+	if err != nil || len(pending) != 1 || time.Since(start) > time.Second {
+		t.Errorf("expected BTC-USD pending without waiting got %v, %v after %s", pending, err, time.Since(start))
+	}
+}
+
+// TestStatusTracker_Heartbeat - tests staleness of trading pairs whose heartbeats stop or report missing matches
+func TestStatusTracker_Heartbeat(t *testing.T) {
+	now := time.Now()
+	tracker := NewStatusTracker([]string{"BTC-USD", "ETH-USD"})
+	tracker.now = func() time.Time { return now }
+	tracker.SetHeartbeatTimeout(5 * time.Second)
+	tracker.Subscribed([]string{"BTC-USD", "ETH-USD"})
+
+	// BTC-USD heartbeat reports trade 12 while only trade 10 was received
+	tracker.Matched("BTC-USD", 10)
+	tracker.Heartbeat(model.Heartbeat{ProductID: "BTC-USD", LastTradeID: 12, Sequence: 100})
+	tracker.Matched("ETH-USD", 3)
+	tracker.Heartbeat(model.Heartbeat{ProductID: "ETH-USD", LastTradeID: 3, Sequence: 50})
+
+	stale := tracker.CheckStale()
+	if len(stale) != 1 || stale[0].Pair != "BTC-USD" || stale[0].Reason != "heartbeat last_trade_id 12 ahead of last match 10" {
+		t.Fatalf("expected BTC-USD to be stale got %+v", stale)
+	}
+	// staleness is reported once
+	if stale = tracker.CheckStale(); len(stale) != 0 {
+		t.Errorf("expected no newly stale trading pairs got %+v", stale)
+	}
+
+	// ETH-USD heartbeats stop, BTC-USD catches up
+	now = now.Add(6 * time.Second)
+	tracker.Matched("BTC-USD", 12)
+	tracker.Heartbeat(model.Heartbeat{ProductID: "BTC-USD", LastTradeID: 12, Sequence: 106})
+
+	stale = tracker.CheckStale()
+	if len(stale) != 1 || stale[0].Pair != "ETH-USD" || stale[0].Reason != "no heartbeat for 6s" {
+		t.Fatalf("expected ETH-USD to be stale got %+v", stale)
+	}
+	if status, _ := tracker.Get("BTC-USD"); status.Status != StatusSubscribed || status.HeartbeatSequence != 106 {
+		t.Errorf("expected BTC-USD to recover got %+v", status)
+	}
+}
+
+// TestStatusTracker_HeartbeatBaseline - tests that matches lost right after subscribing are detected against the first heartbeat
+func TestStatusTracker_HeartbeatBaseline(t *testing.T) {
+	tracker := NewStatusTracker([]string{"BTC-USD"})
+	tracker.SetHeartbeatTimeout(5 * time.Second)
+	tracker.Subscribed([]string{"BTC-USD"})
+
+	// trades before subscribing were never expected
+	tracker.Heartbeat(model.Heartbeat{ProductID: "BTC-USD", LastTradeID: 100})
+	if stale := tracker.CheckStale(); len(stale) != 0 {
+		t.Fatalf("expected no stale trading pairs got %+v", stale)
+	}
+
+	// trade 101 happened, but no match was received
+	tracker.Heartbeat(model.Heartbeat{ProductID: "BTC-USD", LastTradeID: 101})
+	stale := tracker.CheckStale()
+	if len(stale) != 1 || stale[0].Reason != "heartbeat last_trade_id 101 ahead of last match 100" || !stale[0].HeartbeatStale {
+		t.Fatalf("expected BTC-USD to be stale got %+v", stale)
+	}
+
+	// resubscribing starts a new baseline
+	tracker.Subscribed([]string{"BTC-USD"})
+	tracker.Heartbeat(model.Heartbeat{ProductID: "BTC-USD", LastTradeID: 110})
+	if status, _ := tracker.Get("BTC-USD"); status.Status != StatusSubscribed {
+		t.Errorf("expected status %s got %s", StatusSubscribed, status.Status)
+	}
+}
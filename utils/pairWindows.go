@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/decimal"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AlertAbove - VWAP is above ALERT_ABOVE threshold of trading pair
+	AlertAbove = "above"
+	// AlertBelow - VWAP is below ALERT_BELOW threshold of trading pair
+	AlertBelow = "below"
+)
+
+// PairWindows - VWAP utils of all slide windows of a trading pair.
+// Each trade is parsed once and added to all windows in a single pass.
+// It is safe for concurrent use, readers never see a trade added to only some of the windows.
+type PairWindows struct {
+	Pair string
+	// Windows - VWAP utils in configured order, the first one is the primary window
+	Windows []*VWAPUtil
+	// mu - guards adding trades to all windows at once, and alerts
+	mu sync.Mutex
+	// alertAbove and alertBelow - VWAP thresholds of primary window, nil if not configured
+	alertAbove *float64
+	alertBelow *float64
+	// alert - AlertAbove or AlertBelow while VWAP is beyond a threshold, empty otherwise
+	alert string
+}
+
+// NewPairWindows - initializes a set of slide windows for a trading pair
+func NewPairWindows(pair string, windows ...*VWAPUtil) *PairWindows {
+	return &PairWindows{
+		Pair:    pair,
+		Windows: windows,
+	}
+}
+
+// SetAlerts - sets VWAP thresholds of primary window which are logged when crossed, nil disables a threshold
+func (pw *PairWindows) SetAlerts(above, below *float64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.alertAbove = above
+	pw.alertBelow = below
+}
+
+// Add - adds a new data point to all slide windows, timestamped with current time
+func (pw *PairWindows) Add(newPrice, newVolume float64) {
+	pw.AddAt(newPrice, newVolume, time.Now())
+}
+
+// AddAt - adds a new data point with the given trade time to all slide windows
+func (pw *PairWindows) AddAt(newPrice, newVolume float64, at time.Time) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	for _, util := range pw.Windows {
+		util.AddAt(newPrice, newVolume, at)
+	}
+	pw.checkAlerts()
+}
+
+// AddDecimalAt - adds a new data point with the given trade time to all slide windows, exactly in decimal mode
+func (pw *PairWindows) AddDecimalAt(newPrice, newVolume decimal.Decimal, at time.Time) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	for _, util := range pw.Windows {
+		util.AddDecimalAt(newPrice, newVolume, at)
+	}
+	pw.checkAlerts()
+}
+
+// checkAlerts - logs when VWAP of primary window crosses an alert threshold, or returns within thresholds.
+// Must be called holding mu.
+func (pw *PairWindows) checkAlerts() {
+	if pw.alertAbove == nil && pw.alertBelow == nil {
+		return
+	}
+
+	vwap := pw.Windows[0].GetVWAP()
+	alert := ""
+	switch {
+	case math.IsNaN(vwap):
+	case pw.alertAbove != nil && vwap > *pw.alertAbove:
+		alert = AlertAbove
+	case pw.alertBelow != nil && vwap < *pw.alertBelow:
+		alert = AlertBelow
+	}
+	if alert == pw.alert {
+		return
+	}
+
+	switch alert {
+	case AlertAbove:
+		log.Printf("alert: %s VWAP %f above %f", pw.Pair, vwap, *pw.alertAbove)
+	case AlertBelow:
+		log.Printf("alert: %s VWAP %f below %f", pw.Pair, vwap, *pw.alertBelow)
+	default:
+		log.Printf("alert cleared: %s VWAP %f back within thresholds", pw.Pair, vwap)
+	}
+	pw.alert = alert
+}
+
+// Alert - returns AlertAbove or AlertBelow while VWAP of primary window is beyond a threshold, empty otherwise
+func (pw *PairWindows) Alert() string {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.alert
+}
+
+// replay - fills slide windows with trades of previous slide windows of the same trading pair, e.g. after settings changed.
+// Each window is filled from the previous window holding most trades, so as much history as possible is kept.
+func (pw *PairWindows) replay(previous *PairWindows) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	source := previous.Windows[0]
+	for _, util := range previous.Windows {
+		if util.Len() > source.Len() {
+			source = util
+		}
+	}
+
+	for _, util := range pw.Windows {
+		util.replay(source)
+	}
+
+	// only report alerts which changed with new thresholds
+	pw.alert = previous.alert
+	pw.checkAlerts()
+}
+
+// MarkDegraded - marks all slide windows as degraded
+func (pw *PairWindows) MarkDegraded() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	for _, util := range pw.Windows {
+		util.MarkDegraded()
+	}
+}
+
+// Snapshot - returns current state of the primary window, with state of all windows in Windows
+func (pw *PairWindows) Snapshot() VWAPSnapshot {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	windows := make([]VWAPSnapshot, len(pw.Windows))
+	for i, util := range pw.Windows {
+		windows[i] = util.Snapshot()
+	}
+
+	snapshot := windows[0]
+	snapshot.Windows = windows
+	snapshot.Alert = pw.alert
+	return snapshot
+}
+
+// ToString - output as string, a line per slide window
+func (pw *PairWindows) ToString() string {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	var lines []string
+	for _, util := range pw.Windows {
+		lines = append(lines, util.ToString())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPairWindows_AddAt - tests that a trade is added to all slide windows
+func TestPairWindows_AddAt(t *testing.T) {
+	windows := NewPairWindows("BTC-USD", NewVWAPUtil(1, "BTC-USD"), NewTimeVWAPUtil(time.Hour, "BTC-USD"))
+	at := time.Now()
+
+	windows.AddAt(1, 1, at)
+	windows.AddAt(4, 1, at)
+
+	if windows.Windows[0].Len() != 1 || windows.Windows[1].Len() != 2 {
+		t.Errorf("expected %d and %d trades got %d and %d", 1, 2, windows.Windows[0].Len(), windows.Windows[1].Len())
+	}
+}
+
+// TestPairWindows_ToString - tests that trade count windows which are not filled yet are told apart by their size
+func TestPairWindows_ToString(t *testing.T) {
+	expected := `Trading Pair for the latest 50 trades (2 trades): BTC-USD, VWAP: 3.333333
+Trading Pair for the latest 200 trades (2 trades): BTC-USD, VWAP: 3.333333`
+	windows := NewPairWindows("BTC-USD", NewVWAPUtil(50, "BTC-USD"), NewVWAPUtil(200, "BTC-USD"))
+	windows.Add(2, 1)
+	windows.Add(4, 1)
+
+	result := windows.ToString()
+	if result != expected {
+		t.Errorf("expected \n%s \ngot \n%s", expected, result)
+	}
+}
+
+// TestPairWindows_Snapshot - tests that snapshot describes primary window and holds all windows
+func TestPairWindows_Snapshot(t *testing.T) {
+	windows := NewPairWindows("BTC-USD", NewVWAPUtil(50, "BTC-USD"), NewTimeVWAPUtil(time.Minute, "BTC-USD"))
+	windows.Add(2, 1)
+
+	snapshot := windows.Snapshot()
+	if snapshot.WindowLabel() != "50" || len(snapshot.Windows) != 2 || snapshot.Windows[1].WindowLabel() != "1m0s" {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+	if len(snapshot.AllWindows()) != 2 || len(snapshot.Windows[0].AllWindows()) != 1 {
+		t.Errorf("expected %d windows got %d", 2, len(snapshot.AllWindows()))
+	}
+}
+
+// TestPairWindows_Alerts - tests that alert follows VWAP of primary window across thresholds
+func TestPairWindows_Alerts(t *testing.T) {
+	above, below := 10.0, 5.0
+	windows := NewPairWindows("BTC-USD", NewVWAPUtil(1, "BTC-USD"))
+	windows.SetAlerts(&above, &below)
+
+	for _, step := range []struct {
+		price    float64
+		expected string
+	}{
+		{7, ""},
+		{11, AlertAbove},
+		{12, AlertAbove},
+		{4, AlertBelow},
+		{6, ""},
+	} {
+		windows.Add(step.price, 1)
+		if windows.Alert() != step.expected || windows.Snapshot().Alert != step.expected {
+			t.Errorf("price %f: expected alert %q got %q", step.price, step.expected, windows.Alert())
+		}
+	}
+}
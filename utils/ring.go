@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/decimal"
+	"time"
+)
+
+// minRingCapacity - initial capacity of rings which grow on demand
+const minRingCapacity = 16
+
+// trade - a single trade in slide window
+type trade struct {
+	price  float64
+	volume float64
+	at     time.Time
+	// exactPrice and exactVolume - only set in decimal mode
+	exactPrice  decimal.Decimal
+	exactVolume decimal.Decimal
+}
+
+// tradeRing - FIFO of trades backed by a ring buffer.
+// Capacity is fixed when it is created with one, otherwise the buffer doubles whenever it is full.
+type tradeRing struct {
+	buffer []trade
+	head   int
+	size   int
+	fixed  bool
+}
+
+// newTradeRing - initializes a ring with fixed capacity, or a growing ring if capacity is not positive
+func newTradeRing(capacity int) *tradeRing {
+	if capacity <= 0 {
+		return &tradeRing{buffer: make([]trade, minRingCapacity)}
+	}
+	return &tradeRing{buffer: make([]trade, capacity), fixed: true}
+}
+
+// len - number of trades in ring
+func (r *tradeRing) len() int {
+	return r.size
+}
+
+// full - reports whether a fixed capacity ring is full
+func (r *tradeRing) full() bool {
+	return r.fixed && r.size == len(r.buffer)
+}
+
+// at - returns i-th oldest trade
+func (r *tradeRing) at(i int) *trade {
+	return &r.buffer[(r.head+i)%len(r.buffer)]
+}
+
+// push - appends a trade, growing buffer if needed. Must not be called on a full fixed capacity ring.
+func (r *tradeRing) push(value trade) {
+	if r.size == len(r.buffer) {
+		grown := make([]trade, 2*len(r.buffer))
+		for i := 0; i < r.size; i++ {
+			grown[i] = *r.at(i)
+		}
+		r.buffer = grown
+		r.head = 0
+	}
+	r.buffer[(r.head+r.size)%len(r.buffer)] = value
+	r.size++
+}
+
+// pop - removes and returns oldest trade
+func (r *tradeRing) pop() trade {
+	value := r.buffer[r.head]
+	// release references held by decimals
+	r.buffer[r.head] = trade{}
+	r.head = (r.head + 1) % len(r.buffer)
+	r.size--
+	return value
+}
+
+// indexDeque - double ended queue of trade indices backed by a growing ring buffer
+type indexDeque struct {
+	buffer []int
+	head   int
+	size   int
+}
+
+// newIndexDeque - initializes a deque with initial capacity
+func newIndexDeque(capacity int) *indexDeque {
+	if capacity <= 0 {
+		capacity = minRingCapacity
+	}
+	return &indexDeque{buffer: make([]int, capacity)}
+}
+
+// len - number of indices in deque
+func (d *indexDeque) len() int {
+	return d.size
+}
+
+// front - returns first index
+func (d *indexDeque) front() int {
+	return d.buffer[d.head]
+}
+
+// back - returns last index
+func (d *indexDeque) back() int {
+	return d.buffer[(d.head+d.size-1)%len(d.buffer)]
+}
+
+// pushBack - appends an index, growing buffer if needed
+func (d *indexDeque) pushBack(index int) {
+	if d.size == len(d.buffer) {
+		grown := make([]int, 2*len(d.buffer))
+		for i := 0; i < d.size; i++ {
+			grown[i] = d.buffer[(d.head+i)%len(d.buffer)]
+		}
+		d.buffer = grown
+		d.head = 0
+	}
+	d.buffer[(d.head+d.size)%len(d.buffer)] = index
+	d.size++
+}
+
+// popFront - removes first index
+func (d *indexDeque) popFront() {
+	d.head = (d.head + 1) % len(d.buffer)
+	d.size--
+}
+
+// popBack - removes last index
+func (d *indexDeque) popBack() {
+	d.size--
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/helpers"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestTradeRing - tests FIFO order of a fixed and a growing ring across wrap arounds
+func TestTradeRing(t *testing.T) {
+	for _, ring := range []*tradeRing{newTradeRing(3), newTradeRing(0)} {
+		next := 0
+		for i := 0; i < 100; i++ {
+			if ring.full() {
+				value := ring.pop()
+				if int(value.price) != next {
+					t.Fatalf("expected %d got %f", next, value.price)
+				}
+				next++
+			}
+			ring.push(trade{price: float64(i)})
+			// growing ring keeps up to 40 trades
+			if !ring.fixed && ring.len() > 40 {
+				ring.pop()
+				next++
+			}
+		}
+		if int(ring.at(0).price) != next || int(ring.at(ring.len()-1).price) != 99 {
+			t.Errorf("expected trades %d to %d got %f to %f", next, 99, ring.at(0).price, ring.at(ring.len()-1).price)
+		}
+	}
+}
+
+// TestIndexDeque - tests both ends of deque across growth and wrap arounds
+func TestIndexDeque(t *testing.T) {
+	deque := newIndexDeque(2)
+	for i := 0; i < 10; i++ {
+		deque.pushBack(i)
+	}
+	deque.popFront()
+	deque.popBack()
+
+	if deque.len() != 8 || deque.front() != 1 || deque.back() != 8 {
+		t.Errorf("expected 8 indices from 1 to 8 got %d from %d to %d", deque.len(), deque.front(), deque.back())
+	}
+}
+
+// TestVWAPUtil_MinMax - compares min and max prices with a full scan of slide window, for random trades
+func TestVWAPUtil_MinMax(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	window := 50
+	util := NewVWAPUtil(window, "BTC-USD")
+	var prices []float64
+
+	for i := 0; i < 10000; i++ {
+		// few distinct prices, so equal extremes are common
+		price := float64(random.Intn(20))
+		util.Add(price, 1)
+		prices = append(prices, price)
+		if len(prices) > window {
+			prices = prices[1:]
+		}
+
+		if util.maxPrice != helpers.GetMaxFloat(prices) || util.minPrice != helpers.GetMinFloat(prices) {
+			t.Fatalf("trade %d: expected min %f max %f got min %f max %f", i, helpers.GetMinFloat(prices), helpers.GetMaxFloat(prices), util.minPrice, util.maxPrice)
+		}
+	}
+}
+
+// TestVWAPUtil_MinMax_TimeWindow - tests min and max prices once all trades left a time based window
+func TestVWAPUtil_MinMax_TimeWindow(t *testing.T) {
+	start := time.Now()
+	util := NewTimeVWAPUtil(time.Second, "BTC-USD")
+
+	for i := 0; i < 100; i++ {
+		util.AddAt(float64(i), 1, start)
+	}
+	util.AddAt(7, 1, start.Add(time.Minute))
+
+	if util.Len() != 1 || util.maxPrice != 7 || util.minPrice != 7 {
+		t.Errorf("expected single trade with price %d got %d trades, min %f max %f", 7, util.Len(), util.minPrice, util.maxPrice)
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"sync"
+)
+
+const (
+	// SequencePolicyIgnore - sequence anomalies are only counted
+	SequencePolicyIgnore = "ignore"
+	// SequencePolicyLog - sequence anomalies are counted and logged
+	SequencePolicyLog = "log"
+	// SequencePolicyDegrade - gaps mark the slide window of the trading pair as degraded, until the gap leaves the window
+	SequencePolicyDegrade = "degrade"
+	// SequencePolicyResubscribe - gaps trigger a resubscribe of the websocket client
+	SequencePolicyResubscribe = "resubscribe"
+)
+
+// SequenceResult - outcome of checking the sequence of a message
+type SequenceResult int
+
+const (
+	// SequenceOK - message follows previous one
+	SequenceOK SequenceResult = iota
+	// SequenceGap - one or more trades between previous message and this one were not received
+	SequenceGap
+	// SequenceDuplicate - message was already received
+	SequenceDuplicate
+	// SequenceOutOfOrder - message is older than previous one
+	SequenceOutOfOrder
+)
+
+// String - name of sequence result
+func (r SequenceResult) String() string {
+	switch r {
+	case SequenceGap:
+		return "gap"
+	case SequenceDuplicate:
+		return "duplicate"
+	case SequenceOutOfOrder:
+		return "out of order"
+	default:
+		return "ok"
+	}
+}
+
+// SequenceStats - counts of sequence anomalies of a trading pair
+type SequenceStats struct {
+	Gaps       int
+	Duplicates int
+	OutOfOrder int
+}
+
+// SequenceTracker - tracks last received sequence and trade ID of each trading pair.
+// Sequence numbers on the matches channel are shared with the full channel, so they are
+// only contiguous across all message types. Ordering and duplicates are therefore detected
+// using the sequence, while gaps are detected using the trade ID, which is contiguous per product.
+type SequenceTracker struct {
+	mu           sync.Mutex
+	lastSequence map[string]int64
+	lastTradeID  map[string]int64
+	stats        map[string]*SequenceStats
+}
+
+// NewSequenceTracker - initializes a new sequence tracker
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{
+		lastSequence: map[string]int64{},
+		lastTradeID:  map[string]int64{},
+		stats:        map[string]*SequenceStats{},
+	}
+}
+
+// Check - checks a match against the last one received for the same trading pair
+func (st *SequenceTracker) Check(dataPoint model.DataPoint) SequenceResult {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	pair := dataPoint.ProductID
+	stats, ok := st.stats[pair]
+	if !ok {
+		stats = &SequenceStats{}
+		st.stats[pair] = stats
+	}
+
+	lastSequence, seen := st.lastSequence[pair]
+	// first message of trading pair
+	if !seen {
+		st.lastSequence[pair] = dataPoint.Sequence
+		st.lastTradeID[pair] = dataPoint.TradeID
+		return SequenceOK
+	}
+
+	if dataPoint.Sequence == lastSequence {
+		stats.Duplicates++
+		return SequenceDuplicate
+	}
+
+	if dataPoint.Sequence < lastSequence {
+		stats.OutOfOrder++
+		return SequenceOutOfOrder
+	}
+
+	lastTradeID := st.lastTradeID[pair]
+	st.lastSequence[pair] = dataPoint.Sequence
+	st.lastTradeID[pair] = dataPoint.TradeID
+
+	if dataPoint.TradeID > lastTradeID+1 {
+		stats.Gaps++
+		return SequenceGap
+	}
+
+	return SequenceOK
+}
+
+// Rebaseline - forgets last received sequence and trade ID of a trading pair, keeping its stats,
+// so its next match is a new baseline. Trades missed while the connection was replaced are not gaps.
+func (st *SequenceTracker) Rebaseline(pair string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.lastSequence, pair)
+	delete(st.lastTradeID, pair)
+}
+
+// Stats - returns counts of sequence anomalies of a trading pair
+func (st *SequenceTracker) Stats(pair string) SequenceStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	stats, ok := st.stats[pair]
+	if !ok {
+		return SequenceStats{}
+	}
+	return *stats
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"testing"
+)
+
+// createMatch - creates a match data point for testing purposes
+func createMatch(pair string, sequence, tradeID int64) model.DataPoint {
+	return model.DataPoint{
+		Type:      model.TypeMatch,
+		ProductID: pair,
+		Sequence:  sequence,
+		TradeID:   tradeID,
+	}
+}
+
+// TestSequenceTracker_Check - tests detection of each sequence anomaly
+func TestSequenceTracker_Check(t *testing.T) {
+	tracker := NewSequenceTracker()
+
+	cases := []struct {
+		dataPoint model.DataPoint
+		expected  SequenceResult
+	}{
+		// first message of pair
+		{createMatch("BTC-USD", 100, 10), SequenceOK},
+		// sequence may skip, trade ID is contiguous
+		{createMatch("BTC-USD", 105, 11), SequenceOK},
+		{createMatch("BTC-USD", 105, 11), SequenceDuplicate},
+		{createMatch("BTC-USD", 103, 9), SequenceOutOfOrder},
+		// trade 12 was not received
+		{createMatch("BTC-USD", 110, 13), SequenceGap},
+		// pairs are tracked independently
+		{createMatch("ETH-USD", 1, 500), SequenceOK},
+		{createMatch("ETH-USD", 2, 501), SequenceOK},
+	}
+
+	for i, c := range cases {
+		result := tracker.Check(c.dataPoint)
+		if result != c.expected {
+			t.Errorf("case %d: expected %s got %s", i, c.expected, result)
+		}
+	}
+
+	expected := SequenceStats{Gaps: 1, Duplicates: 1, OutOfOrder: 1}
+	if tracker.Stats("BTC-USD") != expected {
+		t.Errorf("expected %+v got %+v", expected, tracker.Stats("BTC-USD"))
+	}
+	if tracker.Stats("ETH-USD") != (SequenceStats{}) {
+		t.Errorf("expected no anomalies for ETH-USD got %+v", tracker.Stats("ETH-USD"))
+	}
+}
+
+// TestSequenceTracker_Rebaseline - tests that a trade ID jump after rebaselining is not a gap, while stats are kept
+func TestSequenceTracker_Rebaseline(t *testing.T) {
+	tracker := NewSequenceTracker()
+	tracker.Check(createMatch("BTC-USD", 100, 10))
+	tracker.Check(createMatch("BTC-USD", 105, 12))
+
+	// trades 13 to 19 happened while reconnecting
+	tracker.Rebaseline("BTC-USD")
+	result := tracker.Check(createMatch("BTC-USD", 200, 20))
+	if result != SequenceOK {
+		t.Errorf("expected %s got %s", SequenceOK, result)
+	}
+	result = tracker.Check(createMatch("BTC-USD", 201, 22))
+	if result != SequenceGap {
+		t.Errorf("expected %s got %s", SequenceGap, result)
+	}
+
+	expected := SequenceStats{Gaps: 2}
+	if tracker.Stats("BTC-USD") != expected {
+		t.Errorf("expected %+v got %+v", expected, tracker.Stats("BTC-USD"))
+	}
+}
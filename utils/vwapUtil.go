@@ -1,20 +1,29 @@
 package utils
 
 import (
-	"CoinbaseMatchesVWAP/helpers"
+	"CoinbaseMatchesVWAP/decimal"
+	"CoinbaseMatchesVWAP/model"
 	"fmt"
 	"math"
+	"strconv"
+	"sync"
+	"time"
 )
 
-// VWAPUtil represents a set of utilities designed to calculate the VWAP (Volume weighted average price) of a specific trading pair
+// VWAPUtil represents a set of utilities designed to calculate the VWAP (Volume weighted average price) of a specific trading pair.
+// It is safe for concurrent use.
 type VWAPUtil struct {
 	// Pair represents the trading pair the utility is initialized for
 	// Defined as identifier
 	Pair string
-	// prices - slice of trading prices in slide window
-	prices []float64
-	// volumes - slice of trading volumes in slide window
-	volumes []float64
+	// mu - guards all fields below
+	mu sync.Mutex
+	// trades - trades in slide window, oldest first
+	trades *tradeRing
+	// maxIndices - indices of trades with strictly decreasing prices, front is index of maximum price in slide window
+	maxIndices *indexDeque
+	// minIndices - indices of trades with strictly increasing prices, front is index of minimum price in slide window
+	minIndices *indexDeque
 	// maxPrice - maximum trading price in slide window
 	maxPrice float64
 	// minPrice - minimum trading price in slide window
@@ -23,80 +32,450 @@ type VWAPUtil struct {
 	cumulatedVolume float64
 	// cumulatedTPV - total TPV of trades in slide window
 	cumulatedTPV float64
+	// cumulatedPV - sum of price * volume of trades in slide window, used by standard calculation mode
+	cumulatedPV float64
+	// mode - calculation mode, model.CalculationModeTypical or model.CalculationModeStandard
+	mode string
 	// window - size of trading window. Limits calculations of VWAP to last N trades.
 	window int
+	// duration - length of time based trading window. Limits calculations of VWAP to trades in last N units of time.
+	// When set, window is ignored.
+	duration time.Duration
+	// latest - most recent trade timestamp seen, used as reference for time based window
+	latest time.Time
+	// added - total number of trades added to slide window, also index of next trade
+	added int
+	// evicted - total number of trades removed from slide window, also index of oldest trade
+	evicted int
+	// degradedUntil - slide window is degraded until this many trades have been evicted
+	degradedUntil int
+	// updated - time the last trade was added
+	updated time.Time
+	// exact - exact decimal state, only kept in decimal mode
+	exact *exactState
+	// precision - digits after decimal point of VWAP output
+	precision int
+}
+
+// VWAPSnapshot - point in time view of the slide window of a trading pair
+type VWAPSnapshot struct {
+	Pair string
+	// VWAP - NaN while slide window is empty
+	VWAP float64
+	// WindowType - model.WindowTypeTrades or model.WindowTypeTime
+	WindowType string
+	// CalculationMode - model.CalculationModeTypical or model.CalculationModeStandard
+	CalculationMode string
+	// Window - size of trade count window
+	Window int
+	// WindowDuration - length of time based window
+	WindowDuration time.Duration
+	// Trades - number of trades in slide window
+	Trades int
+	// WindowFill - fraction of slide window covered by trades (0 to 1)
+	WindowFill      float64
+	MinPrice        float64
+	MaxPrice        float64
+	CumulatedVolume float64
+	// LastTradeTime - time of latest trade
+	LastTradeTime time.Time
+	// UpdatedAt - time latest trade was added
+	UpdatedAt time.Time
+	Degraded  bool
+	// ExactVWAP - VWAP rounded to configured scale in decimal mode, empty otherwise
+	ExactVWAP string
+	// Windows - state of all slide windows of trading pair, only set in snapshots of a trading pair
+	Windows []VWAPSnapshot
+	// Alert - AlertAbove or AlertBelow while VWAP of primary window is beyond an alert threshold, only set in snapshots of a trading pair
+	Alert string
+	// Status - subscription status of trading pair (e.g. StatusSubscribed), only set in snapshots of a trading pair
+	Status string
+	// StatusReason - error of rejected trading pair or cause of staleness
+	StatusReason string
+	// Sequence - counts of missing, duplicate and out of order matches, only set in snapshots of a trading pair
+	Sequence SequenceStats
+}
+
+// AllWindows - returns state of all slide windows of trading pair, the snapshot itself if it holds a single window
+func (s VWAPSnapshot) AllWindows() []VWAPSnapshot {
+	if len(s.Windows) == 0 {
+		return []VWAPSnapshot{s}
+	}
+	return s.Windows
+}
+
+// WindowLabel - identifies slide window of snapshot, e.g. "200" for 200 trades or "5m0s" for 5 minutes
+func (s VWAPSnapshot) WindowLabel() string {
+	if s.WindowType == model.WindowTypeTime {
+		return s.WindowDuration.String()
+	}
+	return strconv.Itoa(s.Window)
 }
 
 // NewVWAPUtil initializes a new VWAPUtil for a trading pair
 func NewVWAPUtil(window int, pair string) *VWAPUtil {
-	// window represents maximum number of data points to slide
+	// window represents maximum number of data points to slide, buffers are allocated once
+	return &VWAPUtil{
+		precision:  model.DefaultPrecision,
+		window:     window,
+		minPrice:   math.MaxFloat64,
+		Pair:       pair,
+		trades:     newTradeRing(window),
+		maxIndices: newIndexDeque(window),
+		minIndices: newIndexDeque(window),
+	}
+}
+
+// NewTimeVWAPUtil initializes a new VWAPUtil for a trading pair using a time based slide window
+func NewTimeVWAPUtil(duration time.Duration, pair string) *VWAPUtil {
+	// duration represents maximum age of data points, relative to the latest one. Buffers grow as needed.
 	return &VWAPUtil{
-		window:   window,
-		minPrice: math.MaxFloat64,
-		Pair:     pair,
-		prices:   []float64{},
+		precision:  model.DefaultPrecision,
+		duration:   duration,
+		minPrice:   math.MaxFloat64,
+		Pair:       pair,
+		trades:     newTradeRing(0),
+		maxIndices: newIndexDeque(0),
+		minIndices: newIndexDeque(0),
+	}
+}
+
+// SetCalculationMode - selects formula used to calculate VWAP:
+// model.CalculationModeTypical (default) uses the typical price (max + min + last) / 3 of the slide window,
+// model.CalculationModeStandard uses sum(price * volume) / sum(volume) over all trades in slide window.
+func (ag *VWAPUtil) SetCalculationMode(mode string) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.mode = mode
+	if ag.exact != nil {
+		ag.exact.mode = mode
+	}
+}
+
+// SetPrecision - sets digits after decimal point of VWAP output
+func (ag *VWAPUtil) SetPrecision(precision int) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.precision = precision
+}
+
+// EnableDecimal - switches to decimal mode, accumulating trades as exact decimals.
+// VWAP is rounded to scale digits after decimal point. Must be called before adding trades.
+func (ag *VWAPUtil) EnableDecimal(scale int32, rounding decimal.RoundingMode) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.exact = &exactState{
+		scale:    scale,
+		rounding: rounding,
+		mode:     ag.mode,
 	}
 }
 
 // removeLast - removes last trade from slide window
 func (ag *VWAPUtil) removeLast() {
-	// subtract volume of oldest data point
-	ag.cumulatedVolume -= ag.volumes[0]
-	ag.volumes = ag.volumes[1:]
+	oldest := ag.trades.pop()
+
+	// subtract volume and price * volume of oldest data point
+	ag.cumulatedVolume -= oldest.volume
+	ag.cumulatedPV -= oldest.price * oldest.volume
+	if ag.exact != nil {
+		ag.exact.remove(oldest.exactPrice, oldest.exactVolume)
+	}
 
-	// check if maximum price is price we are about to delete
-	if ag.maxPrice == ag.prices[0] {
-		// find next max price
-		ag.maxPrice = helpers.GetMaxFloat(ag.prices[1:])
+	// drop oldest trade from min and max candidates, next candidate becomes min or max price
+	if ag.maxIndices.front() == ag.evicted {
+		ag.maxIndices.popFront()
+	}
+	if ag.minIndices.front() == ag.evicted {
+		ag.minIndices.popFront()
 	}
+	ag.evicted++
+	ag.updateExtremes()
+}
 
-	// check if minimum price is price we are about to delete
-	if ag.minPrice == ag.prices[0] {
-		// find next min price
-		ag.minPrice = helpers.GetMinFloat(ag.prices[1:])
+// tradeAt - returns trade with index, which must be in slide window
+func (ag *VWAPUtil) tradeAt(index int) *trade {
+	return ag.trades.at(index - ag.evicted)
+}
+
+// less - compares prices of two trades, exactly in decimal mode
+func (ag *VWAPUtil) less(a, b *trade) bool {
+	if ag.exact != nil {
+		return a.exactPrice.Cmp(b.exactPrice) < 0
 	}
+	return a.price < b.price
+}
+
+// updateExtremes - reads min and max price from fronts of candidate deques
+func (ag *VWAPUtil) updateExtremes() {
+	if ag.trades.len() == 0 {
+		ag.maxPrice = 0
+		ag.minPrice = math.MaxFloat64
+		return
+	}
+	ag.maxPrice = ag.tradeAt(ag.maxIndices.front()).price
+	ag.minPrice = ag.tradeAt(ag.minIndices.front()).price
+}
+
+// Len - returns number of trades in slide window
+func (ag *VWAPUtil) Len() int {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.trades.len()
+}
 
-	// remove oldest price
-	ag.prices = ag.prices[1:]
+// MarkDegraded - marks slide window as degraded (e.g. trades are missing), until all trades currently in it are evicted
+func (ag *VWAPUtil) MarkDegraded() {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.degradedUntil = ag.added
+}
+
+// IsDegraded - reports whether slide window contains trades received before a missing trade
+func (ag *VWAPUtil) IsDegraded() bool {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.isDegraded()
+}
+
+// isDegraded - reports whether slide window is degraded. Must be called holding mu.
+func (ag *VWAPUtil) isDegraded() bool {
+	return ag.evicted < ag.degradedUntil
 }
 
 // GetTypicalPrice - calculates TPV of current slide window
 func (ag *VWAPUtil) GetTypicalPrice(lastPrice float64) float64 {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.typicalPrice(lastPrice)
+}
+
+// typicalPrice - calculates TPV of current slide window. Must be called holding mu.
+func (ag *VWAPUtil) typicalPrice(lastPrice float64) float64 {
 	return (ag.maxPrice + ag.minPrice + lastPrice) / 3
 }
 
-// Add - adds a new data point to slide window
+// Add - adds a new data point to slide window, timestamped with current time
 func (ag *VWAPUtil) Add(newPrice, newVolume float64) {
-	// if max number of trades in window has been reached, discard tail
-	if len(ag.prices) == ag.window {
-		ag.removeLast()
+	ag.AddAt(newPrice, newVolume, time.Now())
+}
+
+// AddAt - adds a new data point with the given trade time to slide window
+func (ag *VWAPUtil) AddAt(newPrice, newVolume float64, at time.Time) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.exact != nil {
+		ag.addDecimal(decimal.NewFromFloat(newPrice), decimal.NewFromFloat(newVolume), at)
+		return
+	}
+	ag.add(trade{price: newPrice, volume: newVolume, at: at})
+}
+
+// AddDecimalAt - adds a new data point with the given trade time to slide window, exactly in decimal mode
+func (ag *VWAPUtil) AddDecimalAt(newPrice, newVolume decimal.Decimal, at time.Time) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.addDecimal(newPrice, newVolume, at)
+}
+
+// addDecimal - adds a new data point given as decimals to slide window. Must be called holding mu.
+func (ag *VWAPUtil) addDecimal(newPrice, newVolume decimal.Decimal, at time.Time) {
+	newTrade := trade{price: newPrice.Float64(), volume: newVolume.Float64(), at: at}
+	if ag.exact != nil {
+		newTrade.exactPrice = newPrice
+		newTrade.exactVolume = newVolume
 	}
+	ag.add(newTrade)
+}
 
-	// check if new data point's price is either the largest or smallest in slide window
-	if newPrice > ag.maxPrice {
-		ag.maxPrice = newPrice
+// add - adds a new data point to slide window, evicting trades which fall out of it. Must be called holding mu.
+func (ag *VWAPUtil) add(newTrade trade) {
+	if newTrade.at.After(ag.latest) {
+		ag.latest = newTrade.at
 	}
 
-	if newPrice < ag.minPrice {
-		ag.minPrice = newPrice
+	if ag.duration > 0 {
+		// discard all trades older than duration, relative to latest trade, including a late new trade
+		cutoff := ag.latest.Add(-ag.duration)
+		if newTrade.at.Before(cutoff) {
+			return
+		}
+		for ag.trades.len() > 0 && ag.trades.at(0).at.Before(cutoff) {
+			ag.removeLast()
+		}
+	} else if ag.trades.full() {
+		// if max number of trades in window has been reached, discard tail
+		ag.removeLast()
 	}
 
-	// keep track of new data point's price and volume
-	ag.prices = append(ag.prices, newPrice)
-	ag.volumes = append(ag.volumes, newVolume)
+	// keep track of new data point's price, volume and time
+	ag.trades.push(newTrade)
+	pushed := ag.trades.at(ag.trades.len() - 1)
 
-	// add volume to cumulated volume in slide window
-	ag.cumulatedVolume += newVolume
+	// candidates not above (below) new price can never become max (min) price again
+	for ag.maxIndices.len() > 0 && !ag.less(pushed, ag.tradeAt(ag.maxIndices.back())) {
+		ag.maxIndices.popBack()
+	}
+	ag.maxIndices.pushBack(ag.added)
+	for ag.minIndices.len() > 0 && !ag.less(ag.tradeAt(ag.minIndices.back()), pushed) {
+		ag.minIndices.popBack()
+	}
+	ag.minIndices.pushBack(ag.added)
+
+	ag.added++
+	ag.updated = time.Now()
+	ag.updateExtremes()
+
+	// add volume and price * volume to cumulated values in slide window
+	ag.cumulatedVolume += newTrade.volume
+	ag.cumulatedPV += newTrade.price * newTrade.volume
+	if ag.exact != nil {
+		ag.exact.add(newTrade.exactPrice, newTrade.exactVolume)
+	}
 	// add TPV to cumulated TPV in slide window
-	ag.cumulatedTPV = ag.GetTypicalPrice(newPrice) * ag.cumulatedVolume
+	ag.cumulatedTPV = ag.typicalPrice(newTrade.price) * ag.cumulatedVolume
+}
+
+// replay - adds trades of another slide window of the same trading pair, oldest first.
+// Trades which don't fit in this slide window are evicted as usual.
+func (ag *VWAPUtil) replay(from *VWAPUtil) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	from.mu.Lock()
+	defer from.mu.Unlock()
+
+	for i := 0; i < from.trades.len(); i++ {
+		oldTrade := *from.trades.at(i)
+		if ag.exact != nil && from.exact == nil {
+			// decimal mode was enabled, exact values are only available as floats
+			oldTrade.exactPrice = decimal.NewFromFloat(oldTrade.price)
+			oldTrade.exactVolume = decimal.NewFromFloat(oldTrade.volume)
+		}
+		ag.add(oldTrade)
+	}
+
+	ag.updated = from.updated
+	if from.isDegraded() {
+		ag.degradedUntil = ag.added
+	}
+}
+
+// exactVWAP - calculates exact VWAP of current slide window, false if not in decimal mode or slide window is empty.
+// Must be called holding mu.
+func (ag *VWAPUtil) exactVWAP() (decimal.Decimal, bool) {
+	if ag.exact == nil || ag.trades.len() == 0 {
+		return decimal.Decimal{}, false
+	}
+	maxPrice := ag.tradeAt(ag.maxIndices.front()).exactPrice
+	minPrice := ag.tradeAt(ag.minIndices.front()).exactPrice
+	lastPrice := ag.trades.at(ag.trades.len() - 1).exactPrice
+	return ag.exact.vwap(maxPrice, minPrice, lastPrice)
 }
 
 // GetVWAP - calculate VWAP of current slide window
 func (ag *VWAPUtil) GetVWAP() float64 {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.vwap()
+}
+
+// vwap - calculates VWAP of current slide window. Must be called holding mu.
+func (ag *VWAPUtil) vwap() float64 {
+	if ag.exact != nil {
+		vwap, ok := ag.exactVWAP()
+		if !ok {
+			return math.NaN()
+		}
+		return vwap.Float64()
+	}
+	if ag.mode == model.CalculationModeStandard {
+		return ag.cumulatedPV / ag.cumulatedVolume
+	}
 	return ag.cumulatedTPV / ag.cumulatedVolume
 }
 
+// GetVWAPDecimal - calculate exact VWAP of current slide window, rounded to configured scale.
+// Returns false if not in decimal mode or slide window is empty.
+func (ag *VWAPUtil) GetVWAPDecimal() (decimal.Decimal, bool) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	return ag.exactVWAP()
+}
+
+// formatVWAP - formats VWAP of current slide window, with all digits of configured scale in decimal mode.
+// Must be called holding mu.
+func (ag *VWAPUtil) formatVWAP() string {
+	if ag.exact != nil {
+		vwap, ok := ag.exactVWAP()
+		if !ok {
+			return "NaN"
+		}
+		return vwap.String()
+	}
+	return fmt.Sprintf("%.*f", ag.precision, ag.vwap())
+}
+
+// Snapshot - returns current state of slide window
+func (ag *VWAPUtil) Snapshot() VWAPSnapshot {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	snapshot := VWAPSnapshot{
+		Pair:            ag.Pair,
+		VWAP:            ag.vwap(),
+		Trades:          ag.trades.len(),
+		CumulatedVolume: ag.cumulatedVolume,
+		LastTradeTime:   ag.latest,
+		UpdatedAt:       ag.updated,
+		Degraded:        ag.isDegraded(),
+		CalculationMode: ag.mode,
+	}
+	if snapshot.CalculationMode == "" {
+		snapshot.CalculationMode = model.CalculationModeTypical
+	}
+
+	if vwap, ok := ag.exactVWAP(); ok {
+		snapshot.ExactVWAP = vwap.String()
+	}
+
+	// min and max prices hold sentinel values while window is empty
+	if ag.trades.len() > 0 {
+		snapshot.MinPrice = ag.minPrice
+		snapshot.MaxPrice = ag.maxPrice
+	}
+
+	if ag.duration > 0 {
+		snapshot.WindowType = model.WindowTypeTime
+		snapshot.WindowDuration = ag.duration
+		if ag.trades.len() > 0 {
+			snapshot.WindowFill = math.Min(1, float64(ag.latest.Sub(ag.trades.at(0).at))/float64(ag.duration))
+		}
+	} else {
+		snapshot.WindowType = model.WindowTypeTrades
+		snapshot.Window = ag.window
+		if ag.window > 0 {
+			snapshot.WindowFill = float64(ag.trades.len()) / float64(ag.window)
+		}
+	}
+
+	return snapshot
+}
+
 // ToString - output as string
 func (ag *VWAPUtil) ToString() string {
-	return fmt.Sprintf("Trading Pair for the latest %d trades: %s, VWAP: %f", len(ag.prices), ag.Pair, ag.GetVWAP())
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	var result string
+	if ag.duration > 0 {
+		result = fmt.Sprintf("Trading Pair for the latest %s (%d trades): %s, VWAP: %s", ag.duration, ag.trades.len(), ag.Pair, ag.formatVWAP())
+	} else {
+		// configured size tells windows apart until they are filled
+		result = fmt.Sprintf("Trading Pair for the latest %d trades (%d trades): %s, VWAP: %s", ag.window, ag.trades.len(), ag.Pair, ag.formatVWAP())
+	}
+
+	if ag.isDegraded() {
+		result += " (DEGRADED)"
+	}
+	return result
 }
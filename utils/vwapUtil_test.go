@@ -1,22 +1,24 @@
 package utils
 
 import (
+	"CoinbaseMatchesVWAP/decimal"
+	"CoinbaseMatchesVWAP/model"
 	"fmt"
 	"testing"
+	"time"
 )
 
 // CreateVWAPUtil - creates a complete VWAPUtil for testing purposes
-func CreateVWAPUtil(window int) VWAPUtil {
-	return VWAPUtil{
-		Pair:            "BTC-USD",
-		cumulatedVolume: 10,
-		volumes:         []float64{1, 2, 3, 2, 3},
-		maxPrice:        5.1,
-		minPrice:        1.1,
-		prices:          []float64{3.2, 1.1, 2.22, 5.1, 2.13},
-		window:          window,
-		cumulatedTPV:    33.733333,
+func CreateVWAPUtil(window int) *VWAPUtil {
+	util := NewVWAPUtil(window, "BTC-USD")
+	volumes := []float64{1, 2, 3, 2, 3}
+	for i, price := range []float64{3.2, 1.1, 2.22, 5.1, 2.13} {
+		util.Add(price, volumes[i])
 	}
+	// fixed cumulated values, independent of calculation
+	util.cumulatedVolume = 10
+	util.cumulatedTPV = 33.733333
+	return util
 }
 
 func roundToTwoDecimal(val float64) string {
@@ -49,12 +51,8 @@ func TestVWAPUtil_removeLast(t *testing.T) {
 		t.Errorf("expected %f got %f", 1.100000, util.minPrice)
 	}
 
-	if len(util.prices) != 4 {
-		t.Errorf("expected %d got %d", 4, len(util.prices))
-	}
-
-	if len(util.volumes) != 4 {
-		t.Errorf("expected %d got %d", 4, len(util.volumes))
+	if util.Len() != 4 {
+		t.Errorf("expected %d got %d", 4, util.Len())
 	}
 }
 
@@ -93,12 +91,8 @@ func TestVWAPUtil_Add(t *testing.T) {
 		t.Errorf("expected %f got %f", 0.500000, util.minPrice)
 	}
 
-	if len(util.prices) != 6 {
-		t.Errorf("expected %d got %d", 6, len(util.prices))
-	}
-
-	if len(util.volumes) != 6 {
-		t.Errorf("expected %d got %d", 6, len(util.volumes))
+	if util.Len() != 6 {
+		t.Errorf("expected %d got %d", 6, util.Len())
 	}
 }
 
@@ -125,13 +119,8 @@ func TestVWAPUtil_Add_FullWindow(t *testing.T) {
 	}
 
 	// length should stay equal to window (one element is added and last one is deleted)
-	if len(util.prices) != 5 {
-		t.Errorf("expected %d got %d", 5, len(util.prices))
-	}
-
-	// length should stay equal to window (one element is added and last one is deleted)
-	if len(util.volumes) != 5 {
-		t.Errorf("expected %d got %d", 5, len(util.volumes))
+	if util.Len() != 5 {
+		t.Errorf("expected %d got %d", 5, util.Len())
 	}
 }
 
@@ -150,7 +139,7 @@ func TestVWAPUtil_GetVWAP(t *testing.T) {
 
 // TestVWAPUtil_ToString - tests ToString method of VWAPUtil
 func TestVWAPUtil_ToString(t *testing.T) {
-	expected := `Trading Pair for the latest 5 trades: BTC-USD, VWAP: 3.373333`
+	expected := `Trading Pair for the latest 5 trades (5 trades): BTC-USD, VWAP: 3.373333`
 	// there are 5 trades in util by default
 	util := CreateVWAPUtil(5)
 
@@ -160,3 +149,226 @@ func TestVWAPUtil_ToString(t *testing.T) {
 		t.Errorf("expected %s got %s", expected, result)
 	}
 }
+
+// TestVWAPUtil_AddAt_TimeWindow - tests AddAt method of VWAPUtil using a time based window
+// trades older than window duration (relative to latest trade) must be dropped
+func TestVWAPUtil_AddAt_TimeWindow(t *testing.T) {
+	start := time.Date(2021, 11, 11, 8, 35, 0, 0, time.UTC)
+	util := NewTimeVWAPUtil(time.Minute, "ETH-BTC")
+
+	util.AddAt(1, 1, start)
+	util.AddAt(2, 1, start.Add(30*time.Second))
+	util.AddAt(3, 1, start.Add(time.Minute))
+
+	// all trades are within 1 minute of latest trade
+	if util.Len() != 3 {
+		t.Errorf("expected %d got %d", 3, util.Len())
+	}
+
+	util.AddAt(4, 2, start.Add(90*time.Second+time.Millisecond))
+
+	// first two trades fall out of window
+	if util.Len() != 2 {
+		t.Errorf("expected %d got %d", 2, util.Len())
+	}
+
+	if util.cumulatedVolume != 3.000000 {
+		t.Errorf("expected %f got %f", 3.000000, util.cumulatedVolume)
+	}
+
+	if util.minPrice != 3.000000 {
+		t.Errorf("expected %f got %f", 3.000000, util.minPrice)
+	}
+
+	if util.maxPrice != 4.000000 {
+		t.Errorf("expected %f got %f", 4.000000, util.maxPrice)
+	}
+
+	// late trade already out of window is not added
+	util.AddAt(100, 5, start.Add(-10*time.Minute))
+	if util.Len() != 2 || util.cumulatedVolume != 3 || util.maxPrice != 4 {
+		t.Errorf("expected late trade to be skipped got %d trades, volume %f, max price %f", util.Len(), util.cumulatedVolume, util.maxPrice)
+	}
+}
+
+// TestVWAPUtil_ToString_TimeWindow - tests ToString method of VWAPUtil using a time based window
+func TestVWAPUtil_ToString_TimeWindow(t *testing.T) {
+	expected := `Trading Pair for the latest 5m0s (1 trades): ETH-BTC, VWAP: 2.000000`
+	util := NewTimeVWAPUtil(5*time.Minute, "ETH-BTC")
+
+	util.AddAt(2, 3, time.Now())
+
+	result := util.ToString()
+
+	if result != expected {
+		t.Errorf("expected %s got %s", expected, result)
+	}
+}
+
+// TestVWAPUtil_MarkDegraded - tests that slide window stays degraded until all trades received before gap are evicted
+func TestVWAPUtil_MarkDegraded(t *testing.T) {
+	expected := `Trading Pair for the latest 2 trades (2 trades): BTC-USD, VWAP: 1.666667 (DEGRADED)`
+	util := NewVWAPUtil(2, "BTC-USD")
+
+	util.Add(1, 1)
+	util.MarkDegraded()
+	util.Add(2, 1)
+
+	if !util.IsDegraded() {
+		t.Error("expected slide window to be degraded")
+	}
+	if util.ToString() != expected {
+		t.Errorf("expected %s got %s", expected, util.ToString())
+	}
+
+	// trade received before gap is evicted
+	util.Add(3, 1)
+
+	if util.IsDegraded() {
+		t.Error("expected slide window not to be degraded")
+	}
+}
+
+// TestVWAPUtil_Decimal_NoDrift - adds and evicts a million trades in decimal mode, cumulated volume must stay exact
+func TestVWAPUtil_Decimal_NoDrift(t *testing.T) {
+	price, _ := decimal.Parse("64632.95")
+	size, _ := decimal.Parse("0.00002416")
+	otherSize, _ := decimal.Parse("0.1")
+	util := NewVWAPUtil(100, "BTC-USD")
+	util.EnableDecimal(8, decimal.RoundHalfEven)
+	at := time.Now()
+
+	for i := 0; i < 1000000; i++ {
+		if i%2 == 0 {
+			util.AddDecimalAt(price, size, at)
+		} else {
+			util.AddDecimalAt(price, otherSize, at)
+		}
+	}
+
+	// window holds 50 trades of each size
+	expected, _ := decimal.Parse("5.001208")
+	if util.exact.cumulatedVolume.Cmp(expected) != 0 {
+		t.Errorf("expected %s got %s", expected, util.exact.cumulatedVolume)
+	}
+
+	vwap, ok := util.GetVWAPDecimal()
+	if !ok || vwap.String() != "64632.95000000" {
+		t.Errorf("expected %s got %s", "64632.95000000", vwap)
+	}
+}
+
+// TestVWAPUtil_ToString_Decimal - tests that VWAP is output with configured scale in decimal mode
+func TestVWAPUtil_ToString_Decimal(t *testing.T) {
+	expected := `Trading Pair for the latest 200 trades (2 trades): BTC-USD, VWAP: 1.67`
+	util := NewVWAPUtil(200, "BTC-USD")
+	util.EnableDecimal(2, decimal.RoundHalfUp)
+
+	if util.ToString() != `Trading Pair for the latest 200 trades (0 trades): BTC-USD, VWAP: NaN` {
+		t.Errorf("expected NaN VWAP got %s", util.ToString())
+	}
+
+	util.Add(1, 1)
+	util.Add(2, 1)
+
+	if util.ToString() != expected {
+		t.Errorf("expected %s got %s", expected, util.ToString())
+	}
+}
+
+// TestVWAPUtil_StandardMode - tests classic VWAP, evicted trades must not contribute to it
+func TestVWAPUtil_StandardMode(t *testing.T) {
+	util := NewVWAPUtil(2, "BTC-USD")
+	util.SetCalculationMode(model.CalculationModeStandard)
+
+	util.Add(1, 1)
+	util.Add(2, 3)
+
+	// (1 * 1 + 2 * 3) / 4
+	if util.GetVWAP() != 1.75 {
+		t.Errorf("expected %f got %f", 1.75, util.GetVWAP())
+	}
+
+	// first trade is evicted: (2 * 3 + 4 * 1) / 4
+	util.Add(4, 1)
+
+	if util.GetVWAP() != 2.5 {
+		t.Errorf("expected %f got %f", 2.5, util.GetVWAP())
+	}
+}
+
+// TestVWAPUtil_StandardMode_Decimal - tests classic VWAP in decimal mode
+func TestVWAPUtil_StandardMode_Decimal(t *testing.T) {
+	util := NewVWAPUtil(2, "BTC-USD")
+	util.SetCalculationMode(model.CalculationModeStandard)
+	util.EnableDecimal(4, decimal.RoundHalfEven)
+
+	util.Add(1, 1)
+	util.Add(2, 3)
+	util.Add(4, 2)
+
+	// (2 * 3 + 4 * 2) / 5
+	vwap, ok := util.GetVWAPDecimal()
+	if !ok || vwap.String() != "2.8000" {
+		t.Errorf("expected %s got %s", "2.8000", vwap)
+	}
+}
+
+// BenchmarkVWAPUtil_Add - measures throughput of Add for growing window sizes, on a random walk of prices
+func BenchmarkVWAPUtil_Add(b *testing.B) {
+	prices := make([]float64, 1<<16)
+	price := 64632.95
+	for i := range prices {
+		price += float64(i%7) - 3
+		prices[i] = price
+	}
+
+	for _, window := range []int{100, 1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			util := NewVWAPUtil(window, "BTC-USD")
+			at := time.Now()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				util.AddAt(prices[i&(len(prices)-1)], 0.01, at)
+			}
+		})
+	}
+}
+
+// TestVWAPUtil_ToString_Precision - tests VWAP output with configured precision
+func TestVWAPUtil_ToString_Precision(t *testing.T) {
+	expected := "Trading Pair for the latest 200 trades (1 trades): ETH-BTC, VWAP: 0.07"
+	util := NewVWAPUtil(200, "ETH-BTC")
+	util.SetPrecision(2)
+	util.Add(0.07296, 1)
+
+	if util.ToString() != expected {
+		t.Errorf("expected %s got %s", expected, util.ToString())
+	}
+}
+
+// TestVWAPUtil_Concurrent - reads slide window while trades are added, run with -race to detect data races
+func TestVWAPUtil_Concurrent(t *testing.T) {
+	util := NewVWAPUtil(10, "BTC-USD")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			util.Add(float64(i), 1)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			if util.Len() != 10 {
+				t.Errorf("expected %d got %d", 10, util.Len())
+			}
+			return
+		default:
+			util.Snapshot()
+			util.ToString()
+		}
+	}
+}
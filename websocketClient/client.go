@@ -1,51 +1,235 @@
 package websocketClient
 
 import (
+	"CoinbaseMatchesVWAP/helpers"
+	"CoinbaseMatchesVWAP/model"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
-	"flag"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
 // SocketClient - defines the methods of a socket client
 type SocketClient interface {
 	SubscribeToMatches(subscriptionMessage string) error
+	Subscribe(channels ...model.Channel) error
+	Unsubscribe(channels ...model.Channel) error
+	Sync() error
+	Subscriptions() (desired, actual Subscriptions)
+	Resubscribe() error
+	SetRecorder(recorder *Recorder)
+	SetKeepalive(policy KeepalivePolicy)
 	Read(output chan []byte)
 	Close() error
 }
 
 type socketClient struct {
+	// ctx - cancels reconnecting, nil if never cancelled
+	ctx context.Context
+	// mu - guards conn (replaced on reconnect), writes to conn and closed
+	mu   sync.Mutex
 	conn *websocket.Conn
 	done chan struct{}
+	// dial - opens a new websocket connection, used to reconnect
+	dial func() (*websocket.Conn, error)
+	// reconnect - policy used to reconnect after a read error
+	reconnect ReconnectPolicy
+	// keepalive - pings and deadlines used to detect dead connections
+	keepalive KeepalivePolicy
+	// subscriptionMessage - latest subscription message, re-sent after reconnecting
+	subscriptionMessage string
+	// desired - subscriptions requested by caller
+	desired Subscriptions
+	// actual - subscriptions acknowledged by server in latest subscriptions message on current connection
+	actual Subscriptions
+	// closed - set by Close, prevents reconnecting
+	closed bool
+	// recorder - optional recorder of every raw frame read
+	recorder *Recorder
 }
 
-// NewSocketClient - initializes a new socket client
-func NewSocketClient(address *string, done chan struct{}) (SocketClient, error) {
-	flag.Parse()
-	log.SetFlags(0)
+// ClientOptions - settings of a new socket client
+type ClientOptions struct {
+	// URL - websocket URL to connect to, e.g. ws://localhost:8080/ws. Built from Scheme and Address when empty.
+	URL string
+	// Scheme - scheme used with Address, wss when empty
+	Scheme string
+	// Address - host, and optionally port and path, used with Scheme
+	Address string
+	// Dialer - dialer used to connect, e.g. with a proxy, TLS configuration or handshake timeout. websocket.DefaultDialer when nil.
+	Dialer *websocket.Dialer
+	// Header - additional HTTP headers sent with the handshake
+	Header http.Header
+	// Reconnect - policy used to reconnect after a read error, e.g. with an OnReconnect hook. DefaultReconnectPolicy when nil.
+	Reconnect *ReconnectPolicy
+}
+
+// url - returns websocket URL to connect to
+func (o ClientOptions) url() (string, error) {
+	raw := o.URL
+	if raw == "" {
+		if o.Address == "" {
+			return "", errors.New("no URL or address configured")
+		}
+		scheme := o.Scheme
+		if scheme == "" {
+			scheme = "wss"
+		}
+		raw = scheme + "://" + o.Address
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return "", fmt.Errorf("invalid URL %q: scheme must be ws or wss", raw)
+	}
+	return u.String(), nil
+}
+
+// NewSocketClient - initializes a new socket client and connects it.
+// ctx cancels connecting, and reconnecting later on.
+func NewSocketClient(ctx context.Context, options ClientOptions, done chan struct{}) (SocketClient, error) {
+	address, err := options.url()
+	if err != nil {
+		return nil, err
+	}
+	dialer := options.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	log.Printf("connecting to %s", address)
 
-	u := url.URL{Scheme: "wss", Host: *address}
-	log.Printf("connecting to %s", u.String())
+	dial := func() (*websocket.Conn, error) {
+		// custom NetDial functions of dialer may not observe ctx
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("dial %s: %w", address, err)
+		}
+		c, resp, err := dialer.DialContext(ctx, address, options.Header)
+		if err != nil && resp != nil {
+			// handshake was rejected by server
+			return nil, fmt.Errorf("dial %s: %w (%s)", address, err, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %w", address, err)
+		}
+		return c, nil
+	}
 
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, err := dial()
 	if err != nil {
-		log.Fatal("dial:", err)
+		return nil, err
+	}
+
+	reconnect := DefaultReconnectPolicy
+	if options.Reconnect != nil {
+		reconnect = *options.Reconnect
 	}
 
 	return &socketClient{
-		conn: c,
-		done: done,
+		ctx:       ctx,
+		conn:      c,
+		done:      done,
+		dial:      dial,
+		reconnect: reconnect,
+		keepalive: DefaultKeepalivePolicy,
 	}, nil
 }
 
 // SubscribeToMatches - sends subscribe message to matches channel
 func (cl *socketClient) SubscribeToMatches(subscriptionMessage string) error {
+	cl.mu.Lock()
+	cl.subscriptionMessage = subscriptionMessage
+	var message model.SubscriptionMessage
+	if json.Unmarshal([]byte(subscriptionMessage), &message) == nil {
+		cl.desiredSubscriptions().Add(message.Channels...)
+	}
+	cl.mu.Unlock()
+
 	// starts at 0 retries
 	return cl.subscribeToMatches(0, subscriptionMessage)
 }
 
+// Subscribe - subscribes to trading pairs of channels, in addition to current subscriptions
+func (cl *socketClient) Subscribe(channels ...model.Channel) error {
+	cl.mu.Lock()
+	cl.desiredSubscriptions().Add(channels...)
+	cl.subscriptionMessage = helpers.GetSubscriptionMessage(model.TypeSubscribe, cl.desired.Channels())
+	cl.mu.Unlock()
+
+	return cl.writeMessage(websocket.TextMessage, []byte(helpers.GetSubscriptionMessage(model.TypeSubscribe, channels)))
+}
+
+// Unsubscribe - unsubscribes from trading pairs of channels
+func (cl *socketClient) Unsubscribe(channels ...model.Channel) error {
+	cl.mu.Lock()
+	cl.desiredSubscriptions().Remove(channels...)
+	cl.subscriptionMessage = ""
+	if len(cl.desired) > 0 {
+		cl.subscriptionMessage = helpers.GetSubscriptionMessage(model.TypeSubscribe, cl.desired.Channels())
+	}
+	cl.mu.Unlock()
+
+	return cl.writeMessage(websocket.TextMessage, []byte(helpers.GetSubscriptionMessage(model.TypeUnsubscribe, channels)))
+}
+
+// Sync - sends subscribe and unsubscribe messages for differences between desired subscriptions
+// and subscriptions acknowledged by server
+func (cl *socketClient) Sync() error {
+	desired, actual := cl.Subscriptions()
+	subscribe, unsubscribe := desired.Diff(actual)
+	if len(unsubscribe) > 0 {
+		err := cl.writeMessage(websocket.TextMessage, []byte(helpers.GetSubscriptionMessage(model.TypeUnsubscribe, unsubscribe)))
+		if err != nil {
+			return err
+		}
+	}
+	if len(subscribe) > 0 {
+		return cl.writeMessage(websocket.TextMessage, []byte(helpers.GetSubscriptionMessage(model.TypeSubscribe, subscribe)))
+	}
+	return nil
+}
+
+// Subscriptions - returns copies of subscriptions requested by caller and subscriptions acknowledged by server
+func (cl *socketClient) Subscriptions() (desired, actual Subscriptions) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.desiredSubscriptions().copy(), cl.actual.copy()
+}
+
+// desiredSubscriptions - returns subscriptions requested by caller, initializing them if needed. Must be called holding mu.
+func (cl *socketClient) desiredSubscriptions() Subscriptions {
+	if cl.desired == nil {
+		cl.desired = Subscriptions{}
+	}
+	return cl.desired
+}
+
+// trackSubscriptions - stores subscriptions acknowledged by server, if message is a subscriptions message
+func (cl *socketClient) trackSubscriptions(message []byte) {
+	// avoid decoding every frame
+	if !bytes.Contains(message, []byte(`"subscriptions"`)) {
+		return
+	}
+	var ack model.SubscriptionMessage
+	if json.Unmarshal(message, &ack) != nil || ack.Type != model.TypeSubscriptions {
+		return
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.actual = NewSubscriptions(ack.Channels...)
+}
+
 // subscribeToMatches - sends subscribe message to matches channel
 func (cl *socketClient) subscribeToMatches(retries int, subscriptionMessage string) error {
 	// limit to 5 retries
@@ -54,7 +238,7 @@ func (cl *socketClient) subscribeToMatches(retries int, subscriptionMessage stri
 	}
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
-	err := cl.conn.WriteMessage(websocket.TextMessage, []byte(subscriptionMessage))
+	err := cl.writeMessage(websocket.TextMessage, []byte(subscriptionMessage))
 	if err != nil {
 		log.Println("failed to write:", err)
 		time.Sleep(time.Second * 2)
@@ -66,15 +250,53 @@ func (cl *socketClient) subscribeToMatches(retries int, subscriptionMessage stri
 	return nil
 }
 
-// Read - starts reading from websocket channel
+// Resubscribe - drops current connection, so Read reconnects and re-sends latest subscription.
+// The server then starts a fresh stream, beginning with a last_match message.
+func (cl *socketClient) Resubscribe() error {
+	return cl.getConn().Close()
+}
+
+// SetRecorder - records every raw frame read to recorder. Must be called before Read.
+func (cl *socketClient) SetRecorder(recorder *Recorder) {
+	cl.recorder = recorder
+}
+
+// SetKeepalive - sets pings and deadlines used to detect dead connections. Must be called before Read.
+func (cl *socketClient) SetKeepalive(policy KeepalivePolicy) {
+	cl.keepalive = policy
+}
+
+// Read - starts reading from websocket channel. Once reading stops, for good, output and done are closed.
 func (cl *socketClient) Read(output chan []byte) {
+	cl.startKeepalive(cl.getConn())
 	go func() {
 		defer close(cl.done)
+		defer close(output)
 		for {
-			_, message, err := cl.conn.ReadMessage()
+			conn := cl.getConn()
+			_, message, err := conn.ReadMessage()
 			if err != nil {
-				log.Println("failed to read:", err)
-				return
+				// a dead connection surfaces as a timeout, and is replaced like any other failed connection
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					log.Println("connection timed out:", err)
+				} else {
+					log.Println("failed to read:", err)
+				}
+				// reconnect unless client was closed on purpose
+				if cl.isClosed() || !cl.reconnectWithBackoff() {
+					return
+				}
+				continue
+			}
+			cl.extendReadDeadline(conn)
+
+			cl.trackSubscriptions(message)
+
+			if cl.recorder != nil {
+				err = cl.recorder.Record(message)
+				if err != nil {
+					log.Println("failed to record:", err)
+				}
 			}
 
 			output <- message
@@ -82,7 +304,108 @@ func (cl *socketClient) Read(output chan []byte) {
 	}()
 }
 
+// reconnectWithBackoff - replaces connection with a new one and re-sends latest subscription.
+// Returns false if all attempts allowed by reconnect policy failed.
+func (cl *socketClient) reconnectWithBackoff() bool {
+	for attempt := 1; attempt <= cl.reconnect.MaxAttempts; attempt++ {
+		delay := cl.reconnect.delay(attempt)
+		if !cl.wait(delay) || cl.isClosed() {
+			return false
+		}
+
+		err := cl.reconnectOnce()
+		cl.reconnect.notify(ReconnectEvent{Attempt: attempt, Delay: delay, Err: err})
+		if err != nil {
+			log.Printf("reconnect attempt %d failed: %v", attempt, err)
+			continue
+		}
+
+		log.Printf("reconnected after %d attempt(s)", attempt)
+		return true
+	}
+
+	log.Printf("giving up after %d reconnect attempt(s)", cl.reconnect.MaxAttempts)
+	return false
+}
+
+// wait - waits for delay, returns false if context of client was cancelled meanwhile
+func (cl *socketClient) wait(delay time.Duration) bool {
+	if cl.ctx == nil {
+		time.Sleep(delay)
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-cl.ctx.Done():
+		return false
+	}
+}
+
+// reconnectOnce - dials a new connection and re-sends latest subscription on it
+func (cl *socketClient) reconnectOnce() error {
+	if cl.dial == nil {
+		return errors.New("no dialer configured")
+	}
+	c, err := cl.dial()
+	if err != nil {
+		return err
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.subscriptionMessage != "" {
+		c.SetWriteDeadline(deadline(cl.keepalive.WriteTimeout))
+		err = c.WriteMessage(websocket.TextMessage, []byte(cl.subscriptionMessage))
+		if err != nil {
+			c.Close()
+			return err
+		}
+	}
+
+	cl.conn.Close()
+	cl.conn = c
+	// new connection starts without subscriptions until server acknowledges them
+	cl.actual = nil
+	cl.startKeepalive(c)
+	return nil
+}
+
+// getConn - returns current connection
+func (cl *socketClient) getConn() *websocket.Conn {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.conn
+}
+
+// isClosed - reports whether Close was called
+func (cl *socketClient) isClosed() bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.closed
+}
+
+// writeMessage - writes a message to current connection
+func (cl *socketClient) writeMessage(messageType int, data []byte) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.conn.SetWriteDeadline(deadline(cl.keepalive.WriteTimeout))
+	return cl.conn.WriteMessage(messageType, data)
+}
+
+// closeTimeout - maximum time to wait for server to answer a close message
+const closeTimeout = time.Second
+
 // Close - closes websocket connection
 func (cl *socketClient) Close() error {
-	return cl.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	cl.mu.Lock()
+	cl.closed = true
+	cl.mu.Unlock()
+
+	err := cl.writeMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	// Read stops once server answers the close message, or after closeTimeout if it doesn't
+	cl.getConn().SetReadDeadline(deadline(closeTimeout))
+	return err
 }
@@ -2,8 +2,12 @@ package websocketClient
 
 import (
 	"CoinbaseMatchesVWAP/helpers"
+	"CoinbaseMatchesVWAP/model"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -135,3 +139,246 @@ func TestSocketClient_Read(t *testing.T) {
 	}
 
 }
+
+// TestSocketClient_Subscribe tests that subscribe and unsubscribe messages are sent and desired subscriptions tracked
+func TestSocketClient_Subscribe(t *testing.T) {
+	t.Parallel()
+	var (
+		s    = &handler{Upgraded: make(chan struct{})}
+		d    = wstest.NewDialer(s)
+		done = make(chan struct{})
+	)
+
+	c, _, err := d.Dial("ws://example.org/ws", nil)
+	require.Nil(t, err)
+
+	<-s.Upgraded
+
+	client := &socketClient{
+		conn: c,
+		done: done,
+	}
+
+	go func() {
+		client.Subscribe(
+			model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD", "ETH-USD"}},
+			model.Channel{Name: model.ChannelHeartbeat, ProductIDs: []string{"BTC-USD"}},
+		)
+		client.Unsubscribe(model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"ETH-USD"}})
+	}()
+
+	// read messages that methods sent to websocket, in order
+	for _, expected := range []string{
+		`{"type":"subscribe","channels":[{"name":"matches","product_ids":["BTC-USD","ETH-USD"]},{"name":"heartbeat","product_ids":["BTC-USD"]}]}`,
+		`{"type":"unsubscribe","channels":[{"name":"matches","product_ids":["ETH-USD"]}]}`,
+	} {
+		_, m, err := s.ReadMessage()
+		require.Nil(t, err)
+		require.Equal(t, expected, string(m))
+	}
+
+	// latest desired subscriptions are re-sent after reconnecting
+	desired, _ := client.Subscriptions()
+	require.Equal(t, []model.Channel{
+		{Name: model.ChannelHeartbeat, ProductIDs: []string{"BTC-USD"}},
+		{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD"}},
+	}, desired.Channels())
+	require.Equal(t, `{"type":"subscribe","channels":[{"name":"heartbeat","product_ids":["BTC-USD"]},{"name":"matches","product_ids":["BTC-USD"]}]}`, client.subscriptionMessage)
+
+	c.Close()
+	s.Close()
+}
+
+// TestSocketClient_Sync tests that acknowledged subscriptions are tracked and differences with desired subscriptions sent
+func TestSocketClient_Sync(t *testing.T) {
+	ack := `{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD","LTC-USD"]}]}`
+	t.Parallel()
+	var (
+		s    = &handler{Upgraded: make(chan struct{})}
+		d    = wstest.NewDialer(s)
+		done = make(chan struct{})
+	)
+
+	c, _, err := d.Dial("ws://example.org/ws", nil)
+	require.Nil(t, err)
+
+	<-s.Upgraded
+
+	client := &socketClient{
+		conn:    c,
+		done:    done,
+		desired: NewSubscriptions(model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD", "ETH-USD"}}),
+	}
+	output := make(chan []byte)
+	client.Read(output)
+
+	// subscriptions message is still passed on to output
+	go s.WriteMessage(websocket.TextMessage, []byte(ack))
+	require.Equal(t, ack, string(<-output))
+	_, actual := client.Subscriptions()
+	require.True(t, actual.Has(model.ChannelMatches, "LTC-USD"))
+
+	go client.Sync()
+	for _, expected := range []string{
+		`{"type":"unsubscribe","channels":[{"name":"matches","product_ids":["LTC-USD"]}]}`,
+		`{"type":"subscribe","channels":[{"name":"matches","product_ids":["ETH-USD"]}]}`,
+	} {
+		_, m, err := s.ReadMessage()
+		require.Nil(t, err)
+		require.Equal(t, expected, string(m))
+	}
+
+	s.Close()
+}
+
+// TestNewSocketClient - tests that NewSocketClient connects to a ws:// URL with an injected dialer and sends configured headers
+func TestNewSocketClient(t *testing.T) {
+	t.Parallel()
+	var (
+		header   = make(chan http.Header, 1)
+		upgrader websocket.Upgrader
+		done     = make(chan struct{})
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header <- r.Header
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			defer conn.Close()
+		}
+	})
+
+	client, err := NewSocketClient(context.Background(), ClientOptions{
+		URL:    "ws://example.org/ws",
+		Dialer: wstest.NewDialer(h),
+		Header: http.Header{"X-Test": []string{"value"}},
+	}, done)
+	require.Nil(t, err)
+	require.NotNil(t, client)
+	require.Equal(t, "value", (<-header).Get("X-Test"))
+}
+
+// TestNewSocketClient_Reconnect - tests that reconnect policy of options is used, reporting each attempt to its hook
+func TestNewSocketClient_Reconnect(t *testing.T) {
+	t.Parallel()
+	var (
+		upgrader websocket.Upgrader
+		dials    int32
+		events   = make(chan ReconnectEvent, 10)
+		done     = make(chan struct{})
+	)
+	// first connection is dropped, reconnecting fails
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&dials, 1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			conn.Close()
+		}
+	})
+
+	client, err := NewSocketClient(context.Background(), ClientOptions{
+		URL:    "ws://example.org/ws",
+		Dialer: wstest.NewDialer(h),
+		Reconnect: &ReconnectPolicy{
+			MaxAttempts: 2,
+			BaseDelay:   time.Millisecond,
+			OnReconnect: func(event ReconnectEvent) {
+				events <- event
+			},
+		},
+	}, done)
+	require.Nil(t, err)
+
+	output := make(chan []byte)
+	client.Read(output)
+	for range output {
+	}
+	<-done
+
+	close(events)
+	var attempts []int
+	for event := range events {
+		require.NotNil(t, event.Err)
+		attempts = append(attempts, event.Attempt)
+	}
+	require.Equal(t, []int{1, 2}, attempts)
+}
+
+// TestNewSocketClient_Errors - tests that NewSocketClient returns errors instead of exiting
+func TestNewSocketClient_Errors(t *testing.T) {
+	t.Parallel()
+	s := &handler{Upgraded: make(chan struct{})}
+
+	// no address
+	_, err := NewSocketClient(context.Background(), ClientOptions{}, make(chan struct{}))
+	require.NotNil(t, err)
+
+	// unsupported scheme
+	_, err = NewSocketClient(context.Background(), ClientOptions{Scheme: "http", Address: "example.org/ws"}, make(chan struct{}))
+	require.NotNil(t, err)
+
+	// handshake rejected by server
+	_, err = NewSocketClient(context.Background(), ClientOptions{
+		URL:    "ws://example.org/missing",
+		Dialer: wstest.NewDialer(s),
+	}, make(chan struct{}))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "404")
+}
+
+// TestNewSocketClient_Cancelled - tests that a cancelled context aborts connecting
+func TestNewSocketClient_Cancelled(t *testing.T) {
+	t.Parallel()
+	s := &handler{Upgraded: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewSocketClient(ctx, ClientOptions{
+		URL:    "ws://example.org/ws/delay",
+		Dialer: wstest.NewDialer(s),
+	}, make(chan struct{}))
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+// TestSocketClient_Close - tests that Read stops, closing output and done, after Close even when server does not answer the close message
+func TestSocketClient_Close(t *testing.T) {
+	t.Parallel()
+	var (
+		s    = &serverHandler{conns: make(chan *websocket.Conn, 1)}
+		dial = dialTo(s, "ws://example.org/ws")
+		done = make(chan struct{})
+	)
+	c, err := dial()
+	require.Nil(t, err)
+	server := <-s.conns
+	defer server.Close()
+
+	// server reads the close message but never answers it
+	server.SetCloseHandler(func(int, string) error { return nil })
+	go func() {
+		for {
+			if _, _, err := server.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	client := &socketClient{conn: c, done: done, dial: dial, reconnect: ReconnectPolicy{MaxAttempts: 3}}
+	output := make(chan []byte)
+	client.Read(output)
+	require.Nil(t, client.Close())
+
+	select {
+	case _, ok := <-output:
+		require.False(t, ok)
+	case <-time.After(3 * time.Second):
+		t.Fatal("output was not closed")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done was not closed")
+	}
+}
@@ -0,0 +1,83 @@
+package websocketClient
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// KeepalivePolicy - configures detection of dead connections. Zero or negative values disable the corresponding check.
+type KeepalivePolicy struct {
+	// PingInterval - interval pings are sent at
+	PingInterval time.Duration
+	// PongTimeout - maximum time to wait for a pong, or any other frame, after sending a ping
+	PongTimeout time.Duration
+	// ReadTimeout - maximum time without receiving any frame
+	ReadTimeout time.Duration
+	// WriteTimeout - maximum time to write a single message
+	WriteTimeout time.Duration
+}
+
+// DefaultKeepalivePolicy - keepalive policy used by NewSocketClient
+var DefaultKeepalivePolicy = KeepalivePolicy{
+	PingInterval: 30 * time.Second,
+	PongTimeout:  10 * time.Second,
+	ReadTimeout:  60 * time.Second,
+	WriteTimeout: 10 * time.Second,
+}
+
+// deadline - returns deadline after timeout from now, zero time (no deadline) if timeout is 0
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// startKeepalive - sets read deadline of a connection, extended by every frame and pong received,
+// and sends pings on it until it fails or is replaced. A missed deadline fails the pending read with a timeout.
+func (cl *socketClient) startKeepalive(conn *websocket.Conn) {
+	policy := cl.keepalive
+	// awaitingPong - set while a ping is unanswered, so later pings do not push back its deadline
+	var awaitingPong int32
+	conn.SetReadDeadline(deadline(policy.ReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		atomic.StoreInt32(&awaitingPong, 0)
+		if cl.isClosed() {
+			return nil
+		}
+		return conn.SetReadDeadline(deadline(policy.ReadTimeout))
+	})
+
+	if policy.PingInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(policy.PingInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			// stop once connection was replaced or client closed
+			if cl.getConn() != conn || cl.isClosed() {
+				return
+			}
+			err := conn.WriteControl(websocket.PingMessage, nil, deadline(policy.WriteTimeout))
+			if err != nil {
+				log.Println("failed to ping:", err)
+				return
+			}
+			if policy.PongTimeout > 0 && atomic.CompareAndSwapInt32(&awaitingPong, 0, 1) {
+				// shortens read deadline until pong is received
+				conn.SetReadDeadline(deadline(policy.PongTimeout))
+			}
+		}
+	}()
+}
+
+// extendReadDeadline - extends read deadline of a connection after a frame was received, unless client is closing
+func (cl *socketClient) extendReadDeadline(conn *websocket.Conn) {
+	if cl.keepalive.ReadTimeout > 0 && !cl.isClosed() {
+		conn.SetReadDeadline(deadline(cl.keepalive.ReadTimeout))
+	}
+}
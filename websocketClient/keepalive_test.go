@@ -0,0 +1,123 @@
+package websocketClient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newKeepaliveClient - returns a client connected to a test server, with given keepalive policy, and the server side of its connection
+func newKeepaliveClient(t *testing.T, s *serverHandler, policy KeepalivePolicy) (*socketClient, *websocket.Conn) {
+	dial := dialTo(s, "ws://example.org/ws")
+	c, err := dial()
+	require.Nil(t, err)
+	server := <-s.conns
+
+	client := &socketClient{
+		conn:      c,
+		done:      make(chan struct{}),
+		dial:      dial,
+		reconnect: ReconnectPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond},
+		keepalive: policy,
+	}
+	return client, server
+}
+
+// TestSocketClient_Read_ReadTimeout - tests that a connection receiving nothing times out and is replaced, instead of hanging Read
+func TestSocketClient_Read_ReadTimeout(t *testing.T) {
+	t.Parallel()
+	s := &serverHandler{conns: make(chan *websocket.Conn, 4)}
+	client, first := newKeepaliveClient(t, s, KeepalivePolicy{ReadTimeout: 100 * time.Millisecond, WriteTimeout: 100 * time.Millisecond})
+	defer first.Close()
+
+	output := make(chan []byte)
+	client.Read(output)
+
+	// server stays silent, like a half-open connection
+	var second *websocket.Conn
+	select {
+	case second = <-s.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not reconnect after read timeout")
+	}
+
+	// messages from new connection are fed to the same output channel
+	go second.WriteMessage(websocket.TextMessage, []byte("after timeout"))
+	select {
+	case result := <-output:
+		require.Equal(t, "after timeout", string(result))
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received after reconnect")
+	}
+
+	// server does not read the close message, so it fails with a write timeout instead of hanging
+	client.Close()
+}
+
+// TestSocketClient_Read_PongTimeout - tests that a connection whose pings are not answered times out before its read timeout
+func TestSocketClient_Read_PongTimeout(t *testing.T) {
+	t.Parallel()
+	s := &serverHandler{conns: make(chan *websocket.Conn, 1)}
+	client, first := newKeepaliveClient(t, s, KeepalivePolicy{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  50 * time.Millisecond,
+		ReadTimeout:  time.Minute,
+		WriteTimeout: 100 * time.Millisecond,
+	})
+	defer first.Close()
+
+	// server reads pings but never answers them
+	first.SetPingHandler(func(string) error { return nil })
+	go func() {
+		for {
+			if _, _, err := first.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	client.Read(make(chan []byte))
+
+	select {
+	case second := <-s.conns:
+		defer second.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not reconnect after pong timeout")
+	}
+
+	client.Close()
+}
+
+// TestSocketClient_Read_KeepAlive - tests that a connection answering pings is kept, even when no messages are received
+func TestSocketClient_Read_KeepAlive(t *testing.T) {
+	t.Parallel()
+	s := &serverHandler{conns: make(chan *websocket.Conn, 1)}
+	client, first := newKeepaliveClient(t, s, KeepalivePolicy{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  50 * time.Millisecond,
+		ReadTimeout:  100 * time.Millisecond,
+		WriteTimeout: 100 * time.Millisecond,
+	})
+	defer first.Close()
+
+	// default ping handler of server answers pings while reading
+	go func() {
+		for {
+			if _, _, err := first.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	client.Read(make(chan []byte))
+
+	select {
+	case <-s.conns:
+		t.Fatal("client reconnected although pings were answered")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	require.Nil(t, client.Close())
+}
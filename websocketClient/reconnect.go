@@ -0,0 +1,63 @@
+package websocketClient
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy - defines how a socket client reconnects after a read error
+type ReconnectPolicy struct {
+	// MaxAttempts - maximum consecutive reconnect attempts before giving up. 0 disables reconnecting.
+	MaxAttempts int
+	// BaseDelay - delay before the first attempt, doubled on each following attempt
+	BaseDelay time.Duration
+	// MaxDelay - upper limit of delay between attempts
+	MaxDelay time.Duration
+	// Jitter - fraction (0 to 1) of each delay which is randomized, so clients don't reconnect in lockstep
+	Jitter float64
+	// OnReconnect - optional hook, called after every reconnect attempt
+	OnReconnect func(event ReconnectEvent)
+}
+
+// ReconnectEvent - describes the outcome of a single reconnect attempt
+type ReconnectEvent struct {
+	// Attempt - number of attempt, starting at 1
+	Attempt int
+	// Delay - time waited before attempt
+	Delay time.Duration
+	// Err - reason attempt failed, nil if reconnected successfully
+	Err error
+}
+
+// DefaultReconnectPolicy - reconnect policy used by NewSocketClient
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MaxAttempts: 10,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.5,
+}
+
+// delay - calculates exponential backoff delay before an attempt
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// randomize part of the delay
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+
+	return delay
+}
+
+// notify - reports a reconnect attempt to hook, if any
+func (p ReconnectPolicy) notify(event ReconnectEvent) {
+	if p.OnReconnect != nil {
+		p.OnReconnect(event)
+	}
+}
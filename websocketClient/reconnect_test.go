@@ -0,0 +1,199 @@
+package websocketClient
+
+import (
+	"CoinbaseMatchesVWAP/helpers"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/posener/wstest"
+	"github.com/stretchr/testify/require"
+)
+
+// serverHandler - test handler which hands over each upgraded connection, so multiple sequential connections can be served
+type serverHandler struct {
+	upgrader websocket.Upgrader
+	conns    chan *websocket.Conn
+}
+
+func (s *serverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ws" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.conns <- conn
+}
+
+// dialTo - returns a dial function connecting to handler through a new in-process connection on every call
+func dialTo(h http.Handler, address string) func() (*websocket.Conn, error) {
+	return func() (*websocket.Conn, error) {
+		c, _, err := wstest.NewDialer(h).Dial(address, nil)
+		return c, err
+	}
+}
+
+// TestReconnectPolicy_delay - tests exponential backoff of ReconnectPolicy
+func TestReconnectPolicy_delay(t *testing.T) {
+	policy := ReconnectPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, value := range expected {
+		result := policy.delay(i + 1)
+		if result != value {
+			t.Errorf("attempt %d: expected %s got %s", i+1, value, result)
+		}
+	}
+
+	// jitter can only shorten delay, up to given fraction
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		result := policy.delay(1)
+		if result > time.Second || result < 500*time.Millisecond {
+			t.Errorf("expected delay between %s and %s got %s", 500*time.Millisecond, time.Second, result)
+		}
+	}
+}
+
+// TestSocketClient_Read_Reconnect - tests that Read reconnects, resubscribes and keeps feeding output channel after connection drops
+func TestSocketClient_Read_Reconnect(t *testing.T) {
+	subscriptionMessage := helpers.GetSubscribeToMatchesMessage([]string{"BTC-USD"})
+	t.Parallel()
+	var (
+		s      = &serverHandler{conns: make(chan *websocket.Conn, 1)}
+		dial   = dialTo(s, "ws://example.org/ws")
+		done   = make(chan struct{})
+		mu     sync.Mutex
+		events []ReconnectEvent
+	)
+
+	c, err := dial()
+	require.Nil(t, err)
+	first := <-s.conns
+
+	client := &socketClient{
+		conn: c,
+		done: done,
+		dial: dial,
+		reconnect: ReconnectPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   10 * time.Millisecond,
+			OnReconnect: func(event ReconnectEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+			},
+		},
+	}
+
+	go client.SubscribeToMatches(subscriptionMessage)
+	_, m, err := first.ReadMessage()
+	require.Nil(t, err)
+	require.Equal(t, subscriptionMessage, string(m))
+
+	output := make(chan []byte)
+	client.Read(output)
+
+	// drop connection without close handshake
+	require.Nil(t, first.Close())
+
+	// client must dial again and re-send subscription
+	var second *websocket.Conn
+	select {
+	case second = <-s.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not reconnect")
+	}
+	_, m, err = second.ReadMessage()
+	require.Nil(t, err)
+	require.Equal(t, subscriptionMessage, string(m))
+
+	// messages from new connection are fed to the same output channel
+	go second.WriteMessage(websocket.TextMessage, []byte("after reconnect"))
+	select {
+	case result := <-output:
+		require.Equal(t, "after reconnect", string(result))
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received after reconnect")
+	}
+
+	mu.Lock()
+	require.Len(t, events, 1)
+	require.Equal(t, 1, events[0].Attempt)
+	require.Nil(t, events[0].Err)
+	mu.Unlock()
+
+	second.Close()
+}
+
+// TestSocketClient_Read_ReconnectGiveUp - tests that done is closed once all reconnect attempts failed
+func TestSocketClient_Read_ReconnectGiveUp(t *testing.T) {
+	t.Parallel()
+	var (
+		s      = &serverHandler{conns: make(chan *websocket.Conn, 1)}
+		done   = make(chan struct{})
+		failed int
+	)
+
+	c, err := dialTo(s, "ws://example.org/ws")()
+	require.Nil(t, err)
+	first := <-s.conns
+
+	client := &socketClient{
+		conn: c,
+		done: done,
+		// server responds with 404 to this address, so every attempt fails
+		dial: dialTo(s, "ws://example.org/missing"),
+		reconnect: ReconnectPolicy{
+			MaxAttempts: 2,
+			BaseDelay:   time.Millisecond,
+			OnReconnect: func(event ReconnectEvent) {
+				if event.Err != nil {
+					failed++
+				}
+			},
+		},
+	}
+
+	client.Read(make(chan []byte))
+	first.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("done was not closed")
+	}
+	if failed != 2 {
+		t.Errorf("expected %d failed attempts got %d", 2, failed)
+	}
+}
+
+// TestSocketClient_reconnectWithBackoff_Cancelled - tests that cancelling context of client stops reconnecting
+func TestSocketClient_reconnectWithBackoff_Cancelled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	client := &socketClient{
+		ctx: ctx,
+		dial: func() (*websocket.Conn, error) {
+			attempts++
+			return nil, errors.New("unreachable")
+		},
+		reconnect: ReconnectPolicy{MaxAttempts: 10, BaseDelay: time.Hour},
+	}
+
+	cancel()
+	if client.reconnectWithBackoff() {
+		t.Error("expected reconnecting to stop got reconnected")
+	}
+	if attempts != 0 {
+		t.Errorf("expected %d attempts got %d", 0, attempts)
+	}
+}
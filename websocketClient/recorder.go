@@ -0,0 +1,48 @@
+package websocketClient
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedFrame - models a single line of a recording, a raw frame and the time it was read
+type RecordedFrame struct {
+	Time  time.Time `json:"time"`
+	Frame string    `json:"frame"`
+}
+
+// Recorder - records raw websocket frames to a JSONL file, one timestamped frame per line
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewRecorder - creates (or truncates) recording file
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Record - appends a frame to recording, timestamped with current time
+func (r *Recorder) Record(frame []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encoder.Encode(RecordedFrame{Time: time.Now().UTC(), Frame: string(frame)})
+}
+
+// Close - closes recording file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
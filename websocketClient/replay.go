@@ -0,0 +1,145 @@
+package websocketClient
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxFrameSize - maximum size of a single line in a recording
+const maxFrameSize = 1024 * 1024
+
+// replayClient - socket client which replays a recording made by Recorder instead of connecting to a websocket server
+type replayClient struct {
+	path string
+	// speed - pacing multiplier relative to original pacing, 0 replays as fast as possible
+	speed    float64
+	done     chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+	recorder *Recorder
+}
+
+// NewReplayClient - initializes a socket client replaying a recording file.
+// With speed 1 frames are replayed at original pacing, with speed 2 twice as fast, with speed 0 as fast as possible.
+func NewReplayClient(path string, speed float64, done chan struct{}) (SocketClient, error) {
+	// fail early if recording can't be opened
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	return &replayClient{
+		path:   path,
+		speed:  speed,
+		done:   done,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// SubscribeToMatches - recording already contains subscribed channels, nothing to send
+func (cl *replayClient) SubscribeToMatches(subscriptionMessage string) error {
+	return nil
+}
+
+// Subscribe - recording already contains subscribed channels, nothing to send
+func (cl *replayClient) Subscribe(channels ...model.Channel) error {
+	return nil
+}
+
+// Unsubscribe - recording already contains subscribed channels, nothing to send
+func (cl *replayClient) Unsubscribe(channels ...model.Channel) error {
+	return nil
+}
+
+// Sync - recording already contains subscribed channels, nothing to send
+func (cl *replayClient) Sync() error {
+	return nil
+}
+
+// Subscriptions - recording already contains subscribed channels, none are tracked
+func (cl *replayClient) Subscriptions() (desired, actual Subscriptions) {
+	return Subscriptions{}, Subscriptions{}
+}
+
+// Resubscribe - recording can't be resubscribed, nothing to send
+func (cl *replayClient) Resubscribe() error {
+	return nil
+}
+
+// SetRecorder - records replayed frames to recorder
+func (cl *replayClient) SetRecorder(recorder *Recorder) {
+	cl.recorder = recorder
+}
+
+// SetKeepalive - recording has no connection to keep alive
+func (cl *replayClient) SetKeepalive(policy KeepalivePolicy) {
+}
+
+// Read - starts replaying recording. output and done are closed once all frames were replayed.
+func (cl *replayClient) Read(output chan []byte) {
+	go func() {
+		defer close(cl.done)
+		defer close(output)
+
+		file, err := os.Open(cl.path)
+		if err != nil {
+			log.Println("failed to open recording:", err)
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxFrameSize)
+
+		var previous time.Time
+		for scanner.Scan() {
+			var frame RecordedFrame
+			err = json.Unmarshal(scanner.Bytes(), &frame)
+			if err != nil {
+				log.Println("failed to parse recorded frame:", err)
+				return
+			}
+
+			// wait for time elapsed between frames, scaled by speed
+			if cl.speed > 0 && !previous.IsZero() && frame.Time.After(previous) {
+				select {
+				case <-time.After(time.Duration(float64(frame.Time.Sub(previous)) / cl.speed)):
+				case <-cl.closed:
+					return
+				}
+			}
+			previous = frame.Time
+
+			if cl.recorder != nil {
+				err = cl.recorder.Record([]byte(frame.Frame))
+				if err != nil {
+					log.Println("failed to record:", err)
+				}
+			}
+
+			select {
+			case output <- []byte(frame.Frame):
+			case <-cl.closed:
+				return
+			}
+		}
+
+		if err = scanner.Err(); err != nil {
+			log.Println("failed to read recording:", err)
+		}
+	}()
+}
+
+// Close - stops replaying
+func (cl *replayClient) Close() error {
+	cl.once.Do(func() {
+		close(cl.closed)
+	})
+	return nil
+}
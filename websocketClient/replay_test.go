@@ -0,0 +1,87 @@
+package websocketClient
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplayClient_Read - records frames and replays them at scaled original pacing
+func TestReplayClient_Read(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	frames := []string{`{"type":"match","product_id":"BTC-USD"}`, `invalid message`, "multi\nline"}
+
+	recorder, err := NewRecorder(path)
+	require.Nil(t, err)
+	for _, frame := range frames {
+		require.Nil(t, recorder.Record([]byte(frame)))
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Nil(t, recorder.Close())
+
+	done := make(chan struct{})
+	// replay twice as fast as recorded
+	client, err := NewReplayClient(path, 2, done)
+	require.Nil(t, err)
+
+	output := make(chan []byte)
+	start := time.Now()
+	client.Read(output)
+
+	for _, frame := range frames {
+		select {
+		case result := <-output:
+			require.Equal(t, frame, string(result))
+		case <-time.After(2 * time.Second):
+			t.Fatal("frame was not replayed")
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("done was not closed after replay")
+	}
+
+	// 200ms of recording replayed at double speed
+	elapsed := time.Since(start)
+	if elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected replay to take about %s got %s", 100*time.Millisecond, elapsed)
+	}
+}
+
+// TestReplayClient_Close - tests that Close stops a paced replay
+func TestReplayClient_Close(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	recorder, err := NewRecorder(path)
+	require.Nil(t, err)
+	require.Nil(t, recorder.Record([]byte("first")))
+	require.Nil(t, recorder.encoder.Encode(RecordedFrame{Time: time.Now().Add(time.Hour), Frame: "an hour later"}))
+	require.Nil(t, recorder.Close())
+
+	done := make(chan struct{})
+	client, err := NewReplayClient(path, 1, done)
+	require.Nil(t, err)
+
+	output := make(chan []byte)
+	client.Read(output)
+	require.Equal(t, "first", string(<-output))
+
+	require.Nil(t, client.Close())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("done was not closed after Close")
+	}
+}
+
+// TestNewReplayClient_MissingFile - tests that a missing recording is reported
+func TestNewReplayClient_MissingFile(t *testing.T) {
+	_, err := NewReplayClient(filepath.Join(t.TempDir(), "missing.jsonl"), 0, make(chan struct{}))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,85 @@
+package websocketClient
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"sort"
+)
+
+// Subscriptions - trading pairs subscribed per channel
+type Subscriptions map[string]map[string]bool
+
+// NewSubscriptions - initializes a set of subscriptions from channels
+func NewSubscriptions(channels ...model.Channel) Subscriptions {
+	subscriptions := Subscriptions{}
+	subscriptions.Add(channels...)
+	return subscriptions
+}
+
+// Add - adds trading pairs of channels to subscriptions
+func (s Subscriptions) Add(channels ...model.Channel) {
+	for _, channel := range channels {
+		if s[channel.Name] == nil {
+			s[channel.Name] = map[string]bool{}
+		}
+		for _, pair := range channel.ProductIDs {
+			s[channel.Name][pair] = true
+		}
+	}
+}
+
+// Remove - removes trading pairs of channels from subscriptions
+func (s Subscriptions) Remove(channels ...model.Channel) {
+	for _, channel := range channels {
+		for _, pair := range channel.ProductIDs {
+			delete(s[channel.Name], pair)
+		}
+		if len(s[channel.Name]) == 0 {
+			delete(s, channel.Name)
+		}
+	}
+}
+
+// Has - reports whether a trading pair is subscribed to a channel
+func (s Subscriptions) Has(channel, pair string) bool {
+	return s[channel][pair]
+}
+
+// Channels - returns subscriptions as channels, sorted by name and trading pair
+func (s Subscriptions) Channels() []model.Channel {
+	var channels []model.Channel
+	for name, pairs := range s {
+		channel := model.Channel{Name: name}
+		for pair := range pairs {
+			channel.ProductIDs = append(channel.ProductIDs, pair)
+		}
+		sort.Strings(channel.ProductIDs)
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+	return channels
+}
+
+// Diff - returns channels to subscribe to and unsubscribe from, so actual subscriptions match s
+func (s Subscriptions) Diff(actual Subscriptions) (subscribe, unsubscribe []model.Channel) {
+	return s.missingFrom(actual), actual.missingFrom(s)
+}
+
+// missingFrom - returns subscriptions of s which are not in other
+func (s Subscriptions) missingFrom(other Subscriptions) []model.Channel {
+	missing := Subscriptions{}
+	for _, channel := range s.Channels() {
+		for _, pair := range channel.ProductIDs {
+			if !other.Has(channel.Name, pair) {
+				missing.Add(model.Channel{Name: channel.Name, ProductIDs: []string{pair}})
+			}
+		}
+	}
+	return missing.Channels()
+}
+
+// copy - returns a copy of subscriptions
+func (s Subscriptions) copy() Subscriptions {
+	return NewSubscriptions(s.Channels()...)
+}
@@ -0,0 +1,43 @@
+package websocketClient
+
+import (
+	"CoinbaseMatchesVWAP/model"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSubscriptions_Diff - tests channels to subscribe to and unsubscribe from, to reach desired subscriptions
+func TestSubscriptions_Diff(t *testing.T) {
+	desired := NewSubscriptions(
+		model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD", "ETH-USD"}},
+		model.Channel{Name: model.ChannelHeartbeat, ProductIDs: []string{"BTC-USD"}},
+	)
+	actual := NewSubscriptions(
+		model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD", "ETH-BTC"}},
+		model.Channel{Name: model.ChannelTicker, ProductIDs: []string{"BTC-USD"}},
+	)
+
+	subscribe, unsubscribe := desired.Diff(actual)
+	require.Equal(t, []model.Channel{
+		{Name: model.ChannelHeartbeat, ProductIDs: []string{"BTC-USD"}},
+		{Name: model.ChannelMatches, ProductIDs: []string{"ETH-USD"}},
+	}, subscribe)
+	require.Equal(t, []model.Channel{
+		{Name: model.ChannelMatches, ProductIDs: []string{"ETH-BTC"}},
+		{Name: model.ChannelTicker, ProductIDs: []string{"BTC-USD"}},
+	}, unsubscribe)
+
+	// no differences once actual subscriptions match
+	subscribe, unsubscribe = desired.Diff(desired.copy())
+	require.Empty(t, subscribe)
+	require.Empty(t, unsubscribe)
+}
+
+// TestSubscriptions_Remove - tests that channels without trading pairs are dropped
+func TestSubscriptions_Remove(t *testing.T) {
+	subscriptions := NewSubscriptions(model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD"}})
+	subscriptions.Remove(model.Channel{Name: model.ChannelMatches, ProductIDs: []string{"BTC-USD"}})
+
+	require.Empty(t, subscriptions.Channels())
+}